@@ -0,0 +1,137 @@
+// Command dedupe-emails detects user accounts whose emails differ only by case,
+// reports them and interactively merges each group into a single account.
+// Run it before applying the 002_normalize_emails migration on existing databases.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/database"
+	"saml-poc/internal/models"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report duplicate accounts, do not change anything")
+	assumeYes := flag.Bool("yes", false, "merge without prompting, keeping the oldest account of each group")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	if cfg.Database.Driver == database.DriverMemory {
+		log.Fatal("The memory driver always stores normalized emails; nothing to deduplicate")
+	}
+
+	// Skip SQLite migrations: the email normalization migration cannot succeed until duplicates are merged
+	db, err := database.New(cfg.Database.Driver, cfg.DatabaseConnectionString(), database.Options{
+		ConnectRetries: cfg.Database.ConnectRetries,
+		RetryBackoff:   cfg.Database.ConnectRetryBackoff,
+		SkipMigrations: true,
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	userRepo := database.NewUserRepository(db)
+
+	duplicates, err := userRepo.FindEmailDuplicates(ctx)
+	if err != nil {
+		log.Fatalf("Failed to find duplicate accounts: %v", err)
+	}
+
+	if len(duplicates) == 0 {
+		fmt.Println("No case-duplicate accounts found")
+	} else {
+		fmt.Printf("Found %d email(s) with case-duplicate accounts:\n", len(duplicates))
+	}
+
+	if *dryRun {
+		for _, dup := range duplicates {
+			printGroup(dup)
+		}
+		return
+	}
+
+	input := bufio.NewReader(os.Stdin)
+	skipped := 0
+	for _, dup := range duplicates {
+		printGroup(dup)
+
+		keep := dup.Users[0]
+		if !*assumeYes {
+			keep = promptKeep(input, dup)
+			if keep == nil {
+				fmt.Println("  Skipped")
+				skipped++
+				continue
+			}
+		}
+
+		var merge []int
+		for _, user := range dup.Users {
+			if user.ID != keep.ID {
+				merge = append(merge, user.ID)
+			}
+		}
+
+		if err := userRepo.MergeUsers(ctx, keep.ID, merge); err != nil {
+			log.Fatalf("Failed to merge accounts for %s: %v", dup.NormalizedEmail, err)
+		}
+		fmt.Printf("  Kept user %d, merged %v\n", keep.ID, merge)
+	}
+
+	if skipped > 0 {
+		fmt.Printf("%d group(s) skipped; emails were not normalized. Re-run to finish.\n", skipped)
+		os.Exit(1)
+	}
+
+	if err := userRepo.NormalizeEmails(ctx); err != nil {
+		log.Fatalf("Failed to normalize emails: %v", err)
+	}
+	fmt.Println("All emails normalized and case-insensitive unique index in place")
+}
+
+// printGroup prints one group of duplicate accounts, numbered for selection
+func printGroup(dup database.EmailDuplicate) {
+	fmt.Printf("\n%s:\n", dup.NormalizedEmail)
+	for i, user := range dup.Users {
+		fmt.Printf("  [%d] id=%d email=%q name=%q created=%s\n",
+			i+1, user.ID, user.Email, user.FullName(), user.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// promptKeep asks which account of a group to keep; it returns nil to skip the group
+func promptKeep(input *bufio.Reader, dup database.EmailDuplicate) *models.User {
+	for {
+		fmt.Printf("  Keep which account? [1-%d, s=skip] (default 1): ", len(dup.Users))
+		answer, err := input.ReadString('\n')
+		if err != nil && answer == "" {
+			return nil
+		}
+
+		answer = strings.TrimSpace(answer)
+		switch {
+		case answer == "":
+			return dup.Users[0]
+		case strings.EqualFold(answer, "s"):
+			return nil
+		}
+
+		if choice, err := strconv.Atoi(answer); err == nil && choice >= 1 && choice <= len(dup.Users) {
+			return dup.Users[choice-1]
+		}
+		fmt.Println("  Invalid choice")
+	}
+}
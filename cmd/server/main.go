@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
+	"strings"
 
 	"saml-poc/internal/config"
 	"saml-poc/internal/database"
 	"saml-poc/internal/handlers"
+	"saml-poc/internal/jobs"
 	"saml-poc/internal/middleware"
+	"saml-poc/internal/models"
+	"saml-poc/internal/notify"
+	"saml-poc/internal/oidc"
+	"saml-poc/internal/proxy"
+	"saml-poc/internal/requestid"
 	"saml-poc/internal/saml"
+	"saml-poc/internal/scim"
+	"saml-poc/internal/tokens"
+	"saml-poc/internal/views"
 )
 
 func main() {
@@ -19,34 +31,121 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Initialize database connection
-	db, err := database.New(cfg.DatabaseConnectionString())
+	// Initialize user, group and API key stores
+	userRepo, groupRepo, apiKeyRepo, closeStore, err := openStores(cfg)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	defer db.Close()
+	defer closeStore()
 
-	// Initialize repositories
-	userRepo := database.NewUserRepository(db)
+	// Cache authorization decisions; store changes to a user or their groups drop their cached decisions
+	authCache := saml.NewDecisionCache(cfg.AuthCache.TTL, cfg.AuthCache.MaxEntries)
+	if authCache != nil {
+		userRepo = database.NewObservedUserStore(userRepo, authCache.InvalidateUser)
+		groupRepo = database.NewObservedGroupStore(groupRepo, authCache.InvalidateUser)
+	}
+
+	// HTML pages are rendered from the embedded templates and any branding overrides
+	pageViews, err := views.New(&cfg.UI)
+	if err != nil {
+		log.Fatalf("Failed to load page templates: %v", err)
+	}
+
+	// Rejected SAML responses are kept for troubleshooting on /debug, and in dev mode every SAML message
+	diagnostics := saml.NewDiagnosticsStore(cfg.Debug.DiagnosticsSize)
+	var traces *saml.TraceStore
+	if cfg.Debug.Enabled && cfg.Debug.DevMode {
+		traces = saml.NewTraceStore(cfg.Debug.TraceSize)
+	}
 
 	// Initialize SAML provider
-	samlProvider, err := saml.NewProvider(cfg)
+	samlProvider, err := saml.NewProvider(cfg, pageViews, diagnostics, traces)
 	if err != nil {
 		log.Fatalf("Failed to create SAML provider: %v", err)
 	}
 
+	// Initialize approval notifier
+	notifier, err := notify.New(&cfg.Notify, fmt.Sprintf("http://%s/admin/approvals", cfg.ServerAddress()))
+	if err != nil {
+		log.Fatalf("Failed to create notifier: %v", err)
+	}
+
 	// Initialize JIT service
-	jitService := saml.NewJITService(userRepo, &cfg.JIT)
+	jitService := saml.NewJITService(userRepo, groupRepo, &cfg.JIT, notifier, authCache)
+
+	// API tokens let SPAs and CLI tools call APIs with a bearer token after SAML login
+	var apiTokens *tokens.APITokens
+	if cfg.APITokens.Enabled {
+		keys, err := tokens.LoadKeySet(cfg.APITokens.SigningKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load API token signing key: %v", err)
+		}
+		apiTokens = tokens.NewAPITokens(&cfg.APITokens, keys)
+	}
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(jitService)
+	authMiddleware := middleware.NewAuthMiddleware(jitService, cfg, apiTokens, apiKeyRepo, pageViews)
 
 	// Initialize handlers
-	homeHandler := handlers.NewHomeHandler()
-	debugHandler := handlers.NewDebugHandler(cfg)
+	homeHandler := handlers.NewHomeHandler(pageViews, cfg.Debug.Enabled)
+	debugHandler := handlers.NewDebugHandler(cfg, authCache, diagnostics, traces, pageViews)
+	approvalHandler := handlers.NewApprovalHandler(userRepo, cfg.Database.QueryTimeout, pageViews)
+	logoutHandler := handlers.NewLogoutHandler(samlProvider.GetMiddleware().Session, pageViews)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo, cfg.Database.QueryTimeout)
+
+	// SCIM provisioning is only exposed when a bearer token is configured
+	var scimHandler *scim.Handler
+	if cfg.SCIM.Token != "" {
+		scimHandler = scim.NewHandler(userRepo, groupRepo, cfg.SCIM.Token, cfg.Database.QueryTimeout)
+	}
 
-	// Setup routes
-	setupRoutes(samlProvider, authMiddleware, homeHandler, debugHandler)
+	// Reverse-proxy mode forwards authenticated requests to upstream applications
+	var proxyHandler *proxy.Handler
+	if len(cfg.Proxy.Routes) > 0 {
+		proxyHandler, err = proxy.NewHandler(cfg.Proxy.Routes, proxy.NewSigner(cfg.Proxy.HeaderSecret), samlProvider.SessionCookieName())
+		if err != nil {
+			log.Fatalf("Failed to configure proxy routes: %v", err)
+		}
+	}
+
+	// Forward-auth lets nginx, Traefik or Envoy ask whether a request may proceed
+	var forwardAuth *proxy.ForwardAuth
+	if cfg.ForwardAuth.Enabled {
+		forwardAuth = proxy.NewForwardAuth(samlProvider.GetMiddleware().Session, proxy.NewSigner(cfg.Proxy.HeaderSecret), cfg.ForwardAuth.LoginURL, pageViews)
+	}
+
+	// The OIDC provider bridge is only exposed when clients are registered
+	var oidcProvider *oidc.Provider
+	if len(cfg.OIDC.Clients) > 0 {
+		keys, err := tokens.LoadKeySet(cfg.OIDC.SigningKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load OIDC signing key: %v", err)
+		}
+		oidcProvider = oidc.NewProvider(&cfg.OIDC, keys, userRepo, cfg.Database.QueryTimeout)
+	}
+
+	// Start background job suspending users whose access has expired; a zero interval disables it
+	if cfg.Lifecycle.ExpiryCheckInterval > 0 {
+		expiryJob := jobs.NewExpiryJob(userRepo, cfg.Lifecycle.ExpiryCheckInterval, cfg.Database.QueryTimeout)
+		go expiryJob.Run(context.Background())
+	} else {
+		log.Println("Expiry job disabled (USER_EXPIRY_CHECK_INTERVAL is not positive)")
+	}
+
+	// Setup routes; route table entries name the built-in pages they serve
+	pages := map[string]http.Handler{
+		"home":      homeHandler,
+		"approvals": approvalHandler,
+		"logout":    logoutHandler,
+	}
+
+	// The debug page is only served when enabled, and then to the allowlisted networks or admins
+	if cfg.Debug.Enabled {
+		pages["debug"] = middleware.AllowNetworks(cfg.Debug.AllowedNetworks, debugHandler, samlProvider.RequireAccount(
+			authMiddleware.DatabaseValidation(authMiddleware.RequireAdmin(debugHandler)),
+		))
+	}
+	setupRoutes(cfg, samlProvider, authMiddleware, pages, apiKeyHandler, scimHandler, proxyHandler, forwardAuth, oidcProvider, apiTokens)
 
 	// Print startup information
 	printStartupInfo(cfg)
@@ -54,49 +153,172 @@ func main() {
 	// Start server
 	serverAddr := fmt.Sprintf(":%s", cfg.Server.Port)
 	log.Printf("Starting server on %s", serverAddr)
-	log.Fatal(http.ListenAndServe(serverAddr, nil))
+	log.Fatal(http.ListenAndServe(serverAddr, requestid.Handler(http.DefaultServeMux)))
+}
+
+// openStores creates the user, group and API key stores for the configured database driver
+func openStores(cfg *config.Config) (database.UserStore, database.GroupStore, database.APIKeyStore, func() error, error) {
+	if cfg.Database.Driver == database.DriverMemory {
+		log.Println("Using in-memory user store (data is not persisted)")
+		return database.NewMemoryUserStore(), database.NewMemoryGroupStore(), database.NewMemoryAPIKeyStore(), func() error { return nil }, nil
+	}
+
+	db, err := database.New(cfg.Database.Driver, cfg.DatabaseConnectionString(), database.Options{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Database.ConnMaxIdleTime,
+		ConnectRetries:  cfg.Database.ConnectRetries,
+		RetryBackoff:    cfg.Database.ConnectRetryBackoff,
+	})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	return database.NewUserRepository(db), database.NewGroupRepository(db), database.NewAPIKeyRepository(db), db.Close, nil
 }
 
-// setupRoutes configures all HTTP routes
+// setupRoutes configures all HTTP routes: the built-in endpoints, then the configured route table
 func setupRoutes(
+	cfg *config.Config,
 	samlProvider *saml.Provider,
 	authMiddleware *middleware.AuthMiddleware,
-	homeHandler *handlers.HomeHandler,
-	debugHandler *handlers.DebugHandler,
+	pages map[string]http.Handler,
+	apiKeyHandler *handlers.APIKeyHandler,
+	scimHandler *scim.Handler,
+	proxyHandler *proxy.Handler,
+	forwardAuth *proxy.ForwardAuth,
+	oidcProvider *oidc.Provider,
+	apiTokens *tokens.APITokens,
 ) {
 	// SAML endpoints - register with prefix pattern
-	http.Handle("/saml/", samlProvider.GetMiddleware())
+	http.Handle("/saml/", samlProvider)
+	http.HandleFunc(saml.LoginPath, samlProvider.HandleLogin)
 
-	// Debug endpoint (unprotected)
-	http.Handle("/debug", debugHandler)
+	// SCIM 2.0 provisioning API, authenticated with its own bearer token
+	if scimHandler != nil {
+		http.Handle(scim.BasePath, scimHandler)
+	}
+
+	// Forward-auth subrequests answer 401 instead of redirecting to the IdP
+	if forwardAuth != nil {
+		http.Handle("/auth/verify", forwardAuth.RequireSession(
+			authMiddleware.DatabaseValidation(forwardAuth),
+		))
+	}
+
+	// OpenID Connect provider; users authenticate with SAML before a code is issued
+	if oidcProvider != nil {
+		http.HandleFunc(oidc.DiscoveryPath, oidcProvider.ServeDiscovery)
+		http.Handle(oidc.JWKSPath, oidcProvider.Keys())
+		http.Handle(oidc.AuthorizePath, samlProvider.RequireAccount(
+			authMiddleware.DatabaseValidation(http.HandlerFunc(oidcProvider.ServeAuthorize)),
+		))
+		http.HandleFunc(oidc.TokenPath, oidcProvider.ServeToken)
+		http.HandleFunc(oidc.UserInfoPath, oidcProvider.ServeUserInfo)
+	}
+
+	// API tokens for the signed-in user, their verification keys, and an API accepting them
+	if apiTokens != nil {
+		http.Handle("/api/token", samlProvider.RequireAccount(
+			authMiddleware.DatabaseValidation(handlers.NewTokenHandler(apiTokens)),
+		))
+		http.Handle("/api/jwks", apiTokens.Keys())
+	}
+	meHandler := authMiddleware.RequireScope(models.ScopeProfileRead, handlers.NewMeHandler())
+	http.Handle("/api/me", authMiddleware.AcceptBearerToken(meHandler, samlProvider.RequireAccount(
+		authMiddleware.DatabaseValidation(meHandler),
+	)))
 
-	// Protected home endpoint with database validation middleware
-	http.Handle("/home", samlProvider.GetMiddleware().RequireAccount(
-		authMiddleware.DatabaseValidation(homeHandler),
+	// Users manage their own long-lived API keys with the SAML session or an API token
+	apiKeys := authMiddleware.AcceptBearerToken(apiKeyHandler, samlProvider.RequireAccount(
+		authMiddleware.DatabaseValidation(apiKeyHandler),
 	))
+	http.Handle(strings.TrimSuffix(handlers.APIKeysPath, "/"), apiKeys)
+	http.Handle(handlers.APIKeysPath, apiKeys)
 
-	// Root redirect to protected home - this will trigger SAML auth if not authenticated
+	// Logo, stylesheets and other branding assets shipped with the template overrides
+	if cfg.UI.TemplateDir != "" {
+		http.Handle(assetsPath, http.StripPrefix(assetsPath, http.FileServer(http.Dir(filepath.Join(cfg.UI.TemplateDir, "assets")))))
+	}
+
+	// Pages, static files and upstream applications from the route table
+	if err := registerRouteTable(http.DefaultServeMux, cfg.Routes, samlProvider, authMiddleware, pages, proxyHandler); err != nil {
+		log.Fatalf("Failed to configure routes: %v", err)
+	}
+
+	// Root redirect to the landing page - this will trigger SAML auth if not authenticated
+	for _, route := range cfg.Routes {
+		if route.Path == "/" {
+			return
+		}
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
 		}
-		http.Redirect(w, r, "/home", http.StatusFound)
+		http.Redirect(w, r, cfg.SAML.DefaultRedirect, http.StatusFound)
 	})
 }
 
 // printStartupInfo prints server startup information
 func printStartupInfo(cfg *config.Config) {
 	fmt.Printf("Server started at http://%s\n", cfg.ServerAddress())
-	fmt.Println("Database connection established")
+	fmt.Printf("Database driver: %s\n", cfg.Database.Driver)
 	fmt.Printf("JIT (Just-In-Time) user creation: %s\n",
 		map[bool]string{true: "ENABLED", false: "DISABLED"}[cfg.JIT.Enabled])
 
 	if cfg.JIT.Enabled {
 		fmt.Printf("  - Default user status: %s\n",
-			map[bool]string{true: "Active", false: "Inactive"}[cfg.JIT.DefaultUserActive])
+			map[bool]string{true: "Active", false: "Pending approval"}[cfg.JIT.DefaultUserActive])
 		fmt.Printf("  - Required attributes: %s\n",
 			map[bool]string{true: "Enforced", false: "Optional"}[cfg.JIT.RequiredAttributesMode])
+		fmt.Printf("  - Policy: %d allowed domain(s), %d blocked domain(s), %d rule(s)\n",
+			len(cfg.JIT.Policy.AllowedDomains), len(cfg.JIT.Policy.BlockedDomains), len(cfg.JIT.Policy.Rules))
+	}
+
+	if cfg.AuthCache.TTL > 0 && cfg.AuthCache.MaxEntries > 0 {
+		fmt.Printf("Authorization cache: TTL %s, up to %d entries\n", cfg.AuthCache.TTL, cfg.AuthCache.MaxEntries)
+	} else {
+		fmt.Println("Authorization cache: DISABLED")
+	}
+
+	fmt.Printf("Approval notifications: %s\n", cfg.Notify.Type)
+	if len(cfg.Admin.Emails) > 0 {
+		fmt.Printf("  - Approval queue: http://%s/admin/approvals\n", cfg.ServerAddress())
+	}
+
+	if cfg.SCIM.Token != "" {
+		fmt.Printf("SCIM provisioning: http://%s%s\n", cfg.ServerAddress(), scim.BasePath)
+	} else {
+		fmt.Println("SCIM provisioning: DISABLED (set SCIM_TOKEN to enable)")
+	}
+
+	fmt.Println("Routes:")
+	for _, route := range cfg.Routes {
+		fmt.Printf("  - http://%s%s -> %s\n", cfg.ServerAddress(), route.Path, describeRoute(route))
+	}
+
+	if cfg.ForwardAuth.Enabled {
+		fmt.Printf("Forward auth: http://%s/auth/verify\n", cfg.ServerAddress())
+	}
+
+	if len(cfg.OIDC.Clients) > 0 {
+		fmt.Printf("OIDC provider: %s%s (%d client(s))\n", cfg.OIDC.Issuer, oidc.DiscoveryPath, len(cfg.OIDC.Clients))
+	}
+
+	if cfg.APITokens.Enabled {
+		fmt.Printf("API tokens: http://%s/api/token (TTL %s, audience %s)\n", cfg.ServerAddress(), cfg.APITokens.TTL, cfg.APITokens.Audience)
+	}
+
+	if cfg.Debug.Enabled {
+		fmt.Printf("Debug page: http://%s/debug (admins and %d allowlisted network(s))\n", cfg.ServerAddress(), len(cfg.Debug.AllowedNetworks))
+		if cfg.Debug.DevMode {
+			fmt.Println("DEV MODE: SAML messages and rejected responses are shown on /debug; do not use in production")
+		}
+	} else if cfg.Debug.DevMode {
+		fmt.Println("DEV MODE has no effect while DEBUG_ENABLED is off")
 	}
 
 	fmt.Println("SAML endpoints:")
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/middleware"
+	"saml-poc/internal/proxy"
+	"saml-poc/internal/saml"
+)
+
+// assetsPath serves the assets directory of UI_TEMPLATE_DIR
+const assetsPath = "/assets/"
+
+// reservedPrefixes are served by built-in endpoints and cannot appear in the route table
+var reservedPrefixes = []string{"/saml/", "/scim/", "/oidc/", "/.well-known/", "/api/", "/auth/", assetsPath}
+
+// adminPages are the built-in pages only admins may open. Their routes always
+// require sign-in and the admin role; roles in the table can only narrow access.
+var adminPages = map[string]bool{"approvals": true}
+
+// registerRouteTable builds the configured route table into mux.
+// pages are the built-in handlers routes can name; proxyHandler serves proxy
+// routes and may be nil when there are none.
+func registerRouteTable(
+	mux *http.ServeMux,
+	routes []config.Route,
+	samlProvider *saml.Provider,
+	authMiddleware *middleware.AuthMiddleware,
+	pages map[string]http.Handler,
+	proxyHandler *proxy.Handler,
+) error {
+	for _, route := range routes {
+		for _, prefix := range reservedPrefixes {
+			if strings.HasPrefix(route.Path, prefix) || route.Path == strings.TrimSuffix(prefix, "/") {
+				return fmt.Errorf("route %s conflicts with built-in endpoints under %s", route.Path, prefix)
+			}
+		}
+
+		var handler http.Handler
+		switch {
+		case route.Handler != "":
+			handler = pages[route.Handler]
+			if handler == nil {
+				return fmt.Errorf("route %s: unknown handler %q", route.Path, route.Handler)
+			}
+		case route.Static != "":
+			handler = http.StripPrefix(strings.TrimSuffix(route.Path, "/"), http.FileServer(http.Dir(route.Static)))
+		case route.Proxy != "":
+			handler = proxyHandler
+		}
+
+		if adminPages[route.Handler] {
+			handler = authMiddleware.RequireAdmin(handler)
+		}
+		if route.Access == config.RouteAccessAuthenticated || adminPages[route.Handler] {
+			if len(route.Roles) > 0 {
+				handler = authMiddleware.RequireRole(route.Roles, handler)
+			}
+			handler = samlProvider.RequireAccount(authMiddleware.DatabaseValidation(handler))
+		}
+
+		mux.Handle(route.Path, handler)
+	}
+	return nil
+}
+
+// describeRoute summarises a route for the startup output
+func describeRoute(route config.Route) string {
+	var target string
+	switch {
+	case route.Handler != "":
+		target = route.Handler + " page"
+	case route.Static != "":
+		target = "files in " + route.Static
+	default:
+		target = "proxy to " + route.Proxy
+	}
+
+	access := route.Access
+	if adminPages[route.Handler] {
+		access = config.RouteAccessAuthenticated + ", role " + middleware.RoleAdmin
+	}
+	if len(route.Roles) > 0 {
+		access += ", roles " + strings.Join(route.Roles, " or ")
+	}
+	return fmt.Sprintf("%s (%s)", target, access)
+}
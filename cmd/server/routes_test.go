@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/database"
+	"saml-poc/internal/handlers"
+	"saml-poc/internal/middleware"
+	"saml-poc/internal/saml"
+	"saml-poc/internal/saml/samltest"
+	"saml-poc/internal/views"
+)
+
+// TestRegisterRouteTablePublicAdminPage routes the approval queue as a public
+// page and checks that it still requires sign-in and the admin role
+func TestRegisterRouteTablePublicAdminPage(t *testing.T) {
+	cfg, idp := samltest.NewConfig(t)
+	cfg.Admin.Emails = []string{"admin@example.com"}
+
+	pageViews, err := views.New(&cfg.UI)
+	if err != nil {
+		t.Fatalf("failed to load page templates: %v", err)
+	}
+	samlProvider, err := saml.NewProvider(cfg, pageViews, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create SAML provider: %v", err)
+	}
+	idp.Trust(samlProvider)
+
+	userRepo := database.NewMemoryUserStore()
+	jitService := saml.NewJITService(userRepo, nil, &cfg.JIT, nil, nil)
+	authMiddleware := middleware.NewAuthMiddleware(jitService, cfg, nil, nil, pageViews)
+	pages := map[string]http.Handler{
+		"approvals": handlers.NewApprovalHandler(userRepo, cfg.Database.QueryTimeout, pageViews),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/saml/", samlProvider)
+	routes := []config.Route{{Path: "/admin/approvals", Access: config.RouteAccessPublic, Handler: "approvals"}}
+	if err := registerRouteTable(mux, routes, samlProvider, authMiddleware, pages, nil); err != nil {
+		t.Fatalf("failed to register routes: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		email string
+		want  int
+	}{
+		{"anonymous", "", http.StatusFound},
+		{"non-admin", "user@example.com", http.StatusForbidden},
+		{"admin", "admin@example.com", http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/admin/approvals", nil)
+			if tc.email != "" {
+				form := idp.Response(t, tc.name+"-1234", map[string]string{"email": tc.email, "firstName": "Test", "lastName": "User"})
+				cookies, err := samltest.SignIn(mux, form)
+				if err != nil {
+					t.Fatalf("failed to sign in: %v", err)
+				}
+				for _, cookie := range cookies {
+					req.AddCookie(cookie)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("got status %d (%s), want %d", rec.Code, rec.Header().Get(views.ErrorCodeHeader), tc.want)
+			}
+		})
+	}
+}
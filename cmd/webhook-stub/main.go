@@ -0,0 +1,38 @@
+// Command webhook-stub is a local stand-in for a notification webhook.
+// It prints every request body it receives, for testing NOTIFY_TYPE=webhook.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, body, "", "  ") != nil {
+			pretty.Reset()
+			pretty.Write(body)
+		}
+
+		fmt.Printf("%s %s\n%s\n\n", r.Method, r.URL.Path, pretty.String())
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("Webhook stub listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
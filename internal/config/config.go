@@ -1,17 +1,37 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	SAML     SAMLConfig
-	JIT      JITConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	SAML        SAMLConfig
+	JIT         JITConfig
+	Admin       AdminConfig
+	Notify      NotifyConfig
+	Lifecycle   LifecycleConfig
+	SCIM        SCIMConfig
+	AuthCache   AuthCacheConfig
+	Proxy       ProxyConfig
+	ForwardAuth ForwardAuthConfig
+	OIDC        OIDCConfig
+	APITokens   APITokenConfig
+	UI          UIConfig
+	Debug       DebugConfig
+	// Routes is the route protection table built into the HTTP router
+	Routes []Route
 }
 
 // ServerConfig holds server-related configuration
@@ -22,12 +42,30 @@ type ServerConfig struct {
 
 // DatabaseConfig holds database-related configuration
 type DatabaseConfig struct {
+	Driver     string // postgres, sqlite or memory
+	SQLitePath string
+
+	// URL is a full PostgreSQL connection URL; when set it overrides the individual fields below
+	URL      string
 	Host     string
 	Port     string
 	User     string
 	Password string
 	DBName   string
 	SSLMode  string
+
+	// QueryTimeout bounds each database call made while serving a request
+	QueryTimeout time.Duration
+
+	// Connection pool settings
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// Startup retry settings for databases that are still booting
+	ConnectRetries      int
+	ConnectRetryBackoff time.Duration
 }
 
 // SAMLConfig holds SAML-related configuration
@@ -37,6 +75,15 @@ type SAMLConfig struct {
 	IdPMetadataPath string
 	CertFile        string
 	KeyFile         string
+
+	// AllowIdPInitiated accepts unsolicited responses; their RelayState may name the page to open
+	AllowIdPInitiated bool
+	// DefaultRedirect is where users land after signing in without a valid deep link
+	DefaultRedirect string
+	// RedirectPaths are the path prefixes on this server users may be returned to after signing in
+	RedirectPaths []string
+	// RedirectHosts are the other hosts users may be returned to after signing in
+	RedirectHosts []string
 }
 
 // JITConfig holds Just-In-Time user creation configuration
@@ -44,6 +91,196 @@ type JITConfig struct {
 	Enabled                bool
 	DefaultUserActive      bool
 	RequiredAttributesMode bool
+	Policy                 JITPolicy
+}
+
+// AdminConfig holds administrator configuration
+type AdminConfig struct {
+	// Emails lists users allowed to use the admin endpoints
+	Emails []string
+}
+
+// NotifyConfig holds configuration for approval notifications
+type NotifyConfig struct {
+	Type       string // log, webhook or smtp
+	WebhookURL string
+
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTo       []string
+}
+
+// LifecycleConfig holds user lifecycle configuration
+type LifecycleConfig struct {
+	// ExpiryCheckInterval is how often users with expired access are suspended
+	ExpiryCheckInterval time.Duration
+}
+
+// SCIMConfig holds SCIM 2.0 provisioning configuration
+type SCIMConfig struct {
+	// Token is the bearer token the IdP presents; the SCIM endpoint is disabled when empty
+	Token string
+}
+
+// AuthCacheConfig holds configuration for the authorization decision cache
+type AuthCacheConfig struct {
+	// TTL bounds how long a decision is reused; 0 disables the cache
+	TTL        time.Duration
+	MaxEntries int
+}
+
+// ProxyConfig holds reverse-proxy mode configuration
+type ProxyConfig struct {
+	// Routes maps path prefixes to upstream applications; derived from the proxy entries of the route table
+	Routes []ProxyRoute
+	// HeaderSecret signs the identity headers sent upstream
+	HeaderSecret string
+}
+
+// Route access levels
+const (
+	RouteAccessPublic        = "public"        // no sign-in required
+	RouteAccessAuthenticated = "authenticated" // SAML sign-in and database validation required
+)
+
+// Route protects a path and says what serves it. Exactly one of Handler,
+// Static and Proxy is set. Paths follow http.ServeMux patterns: a trailing
+// slash matches the whole subtree.
+type Route struct {
+	Path   string `json:"path"`
+	Access string `json:"access"`
+	// Roles restricts an authenticated route to users holding any of these roles
+	Roles []string `json:"roles,omitempty"`
+
+	// Handler names a built-in page such as home, approvals or debug
+	Handler string `json:"handler,omitempty"`
+	// Static is a directory served under Path
+	Static string `json:"static,omitempty"`
+	// Proxy is an upstream URL requests under Path are forwarded to
+	Proxy string `json:"proxy,omitempty"`
+}
+
+// defaultRoutes are the built-in pages; ROUTES_FILE entries with the same path replace them
+var defaultRoutes = []Route{
+	{Path: "/home", Access: RouteAccessAuthenticated, Handler: "home"},
+	{Path: "/admin/approvals", Access: RouteAccessAuthenticated, Roles: []string{"admin"}, Handler: "approvals"},
+	{Path: "/logout", Access: RouteAccessPublic, Handler: "logout"},
+}
+
+// debugRoute is added to the defaults when DEBUG_ENABLED is set. It is public
+// in the table because the debug handler checks the allowlist and admin role itself.
+var debugRoute = Route{Path: "/debug", Access: RouteAccessPublic, Handler: "debug"}
+
+// ProxyRoute forwards requests under Prefix to the Target upstream URL
+type ProxyRoute struct {
+	Prefix string
+	Target string
+}
+
+// ForwardAuthConfig holds configuration for the /auth/verify forward-auth endpoint
+type ForwardAuthConfig struct {
+	Enabled bool
+	// LoginURL is where unauthenticated users are sent to sign in
+	LoginURL string
+}
+
+// UIConfig holds the branding applied to the HTML pages
+type UIConfig struct {
+	// TemplateDir holds templates overriding the embedded defaults and an assets/ directory served at /assets/
+	TemplateDir string
+	// BrandName is shown in page titles and the page header
+	BrandName string
+	// LogoURL is an optional logo shown in the page header
+	LogoURL string
+	// PrimaryColor is the accent colour of headers, links and buttons
+	PrimaryColor string
+}
+
+// DebugConfig holds troubleshooting settings
+type DebugConfig struct {
+	// Enabled registers /debug; it is not served at all otherwise
+	Enabled bool
+	// AllowedNetworks may use /debug without signing in; everyone else needs the admin role.
+	// It is empty unless set, since behind a same-host proxy every request comes from loopback.
+	AllowedNetworks []netip.Prefix
+	// DevMode shows the redacted XML of rejected SAML responses on /debug; never enable it in production
+	DevMode bool
+	// DiagnosticsSize is how many rejected SAML responses are kept for /debug
+	DiagnosticsSize int
+	// TraceSize is how many SAML messages are traced for /debug in dev mode
+	TraceSize int
+}
+
+// colorPattern matches the hex colours accepted for UI_PRIMARY_COLOR
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// OIDCConfig holds configuration for the OpenID Connect provider bridge
+type OIDCConfig struct {
+	// Clients are the registered relying parties; the provider is disabled when empty
+	Clients []OIDCClient
+	// Issuer is the iss claim and the base URL of the OIDC endpoints
+	Issuer string
+	// SigningKeyFile is the RSA key used to sign tokens; defaults to the SAML SP key
+	SigningKeyFile string
+	CodeTTL        time.Duration
+	TokenTTL       time.Duration
+}
+
+// OIDCClient is a relying party allowed to request tokens
+type OIDCClient struct {
+	ID string `json:"client_id"`
+	// Secret authenticates confidential clients; public clients leave it empty and rely on PKCE
+	Secret       string   `json:"client_secret"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// APITokenConfig holds configuration for the JWT API tokens minted at /api/token
+type APITokenConfig struct {
+	Enabled  bool
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+	// RolesClaim is the claim carrying the user's roles
+	RolesClaim string
+	// SigningKeyFile is the RSA key used to sign tokens; defaults to the SAML SP key
+	SigningKeyFile string
+}
+
+// JIT provisioning outcomes
+const (
+	JITOutcomeCreateActive  = "create_active"
+	JITOutcomeCreatePending = "create_pending"
+	JITOutcomeDeny          = "deny"
+)
+
+// JITPolicy holds the provisioning rules evaluated before a JIT user is created
+type JITPolicy struct {
+	// AllowedDomains restricts JIT to these email domains (empty allows all)
+	AllowedDomains []string `json:"allowed_domains"`
+	// BlockedDomains are always denied, even if also allowed
+	BlockedDomains []string `json:"blocked_domains"`
+	// Rules are evaluated in order; the first matching rule decides the outcome
+	Rules []JITRule `json:"rules"`
+	// DefaultOutcome applies when no rule matches; empty falls back to DefaultUserActive
+	DefaultOutcome string `json:"default_outcome"`
+}
+
+// JITRule matches users by email domain, attribute values and group membership
+type JITRule struct {
+	Name string `json:"name"`
+	// EmailDomains matches any of these domains (empty matches all)
+	EmailDomains []string `json:"email_domains"`
+	// Attributes requires each attribute to have the given value, e.g. {"department": "Engineering"}
+	Attributes map[string]string `json:"attributes"`
+	// Groups requires membership in all of these groups
+	Groups []string `json:"groups"`
+	// Outcome is one of create_active, create_pending or deny
+	Outcome string `json:"outcome"`
+	// Reason is shown to the user when the outcome is deny
+	Reason string `json:"reason"`
 }
 
 // Load loads configuration from environment variables with defaults
@@ -54,12 +291,25 @@ func Load() (*Config, error) {
 			Host: getEnv("SERVER_HOST", "localhost"),
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "saml_user"),
-			Password: getEnv("DB_PASSWORD", "saml_password"),
-			DBName:   getEnv("DB_NAME", "saml_sso"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Driver:     getEnv("DB_DRIVER", "postgres"),
+			SQLitePath: getEnv("DB_SQLITE_PATH", "saml_sso.db"),
+			URL:        getEnv("DATABASE_URL", ""),
+			Host:       getEnv("DB_HOST", "localhost"),
+			Port:       getEnv("DB_PORT", "5432"),
+			User:       getEnv("DB_USER", "saml_user"),
+			Password:   getEnv("DB_PASSWORD", "saml_password"),
+			DBName:     getEnv("DB_NAME", "saml_sso"),
+			SSLMode:    getEnv("DB_SSLMODE", "disable"),
+
+			QueryTimeout: getDurationEnv("DB_QUERY_TIMEOUT", 5*time.Second),
+
+			MaxOpenConns:    getIntEnv("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:    getIntEnv("DB_MAX_IDLE_CONNS", 5),
+			ConnMaxLifetime: getDurationEnv("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+			ConnMaxIdleTime: getDurationEnv("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+
+			ConnectRetries:      getIntEnv("DB_CONNECT_RETRIES", 5),
+			ConnectRetryBackoff: getDurationEnv("DB_CONNECT_RETRY_BACKOFF", time.Second),
 		},
 		SAML: SAMLConfig{
 			EntityID:        getEnv("SAML_ENTITY_ID", fmt.Sprintf("http://%s:%s/saml/metadata", getEnv("SERVER_HOST", "localhost"), getEnv("SERVER_PORT", "8080"))),
@@ -67,27 +317,380 @@ func Load() (*Config, error) {
 			IdPMetadataPath: getEnv("SAML_IDP_METADATA_PATH", "configs/idp_metadata.xml"),
 			CertFile:        getEnv("SAML_CERT_FILE", "sp.crt"),
 			KeyFile:         getEnv("SAML_KEY_FILE", "sp.key"),
+
+			AllowIdPInitiated: getBoolEnv("SAML_ALLOW_IDP_INITIATED", false),
+			DefaultRedirect:   getEnv("SAML_DEFAULT_REDIRECT", "/home"),
+			RedirectPaths:     getListEnv("SAML_REDIRECT_PATHS"),
+			// FORWARD_AUTH_REDIRECT_HOSTS is the older name of SAML_REDIRECT_HOSTS
+			RedirectHosts: append(getListEnv("SAML_REDIRECT_HOSTS"), getListEnv("FORWARD_AUTH_REDIRECT_HOSTS")...),
 		},
 		JIT: JITConfig{
 			Enabled:                getBoolEnv("JIT_ENABLED", true),
 			DefaultUserActive:      getBoolEnv("JIT_DEFAULT_USER_ACTIVE", true),
 			RequiredAttributesMode: getBoolEnv("JIT_REQUIRED_ATTRIBUTES", true),
 		},
+		Admin: AdminConfig{
+			Emails: getListEnv("ADMIN_EMAILS"),
+		},
+		Notify: NotifyConfig{
+			Type:         getEnv("NOTIFY_TYPE", "log"),
+			WebhookURL:   getEnv("NOTIFY_WEBHOOK_URL", ""),
+			SMTPHost:     getEnv("NOTIFY_SMTP_HOST", ""),
+			SMTPPort:     getEnv("NOTIFY_SMTP_PORT", "25"),
+			SMTPUsername: getEnv("NOTIFY_SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("NOTIFY_SMTP_PASSWORD", ""),
+			SMTPFrom:     getEnv("NOTIFY_SMTP_FROM", ""),
+			SMTPTo:       getListEnv("NOTIFY_SMTP_TO"),
+		},
+		Lifecycle: LifecycleConfig{
+			ExpiryCheckInterval: getDurationEnv("USER_EXPIRY_CHECK_INTERVAL", 15*time.Minute),
+		},
+		SCIM: SCIMConfig{
+			Token: getEnv("SCIM_TOKEN", ""),
+		},
+		Proxy: ProxyConfig{
+			HeaderSecret: getEnv("PROXY_HEADER_SECRET", ""),
+		},
+		ForwardAuth: ForwardAuthConfig{
+			Enabled:  getBoolEnv("FORWARD_AUTH_ENABLED", false),
+			LoginURL: getEnv("FORWARD_AUTH_LOGIN_URL", "/saml/sso"),
+		},
+		OIDC: OIDCConfig{
+			Issuer:         getEnv("OIDC_ISSUER", fmt.Sprintf("http://%s:%s", getEnv("SERVER_HOST", "localhost"), getEnv("SERVER_PORT", "8080"))),
+			SigningKeyFile: getEnv("OIDC_SIGNING_KEY_FILE", getEnv("SAML_KEY_FILE", "sp.key")),
+			CodeTTL:        getDurationEnv("OIDC_CODE_TTL", time.Minute),
+			TokenTTL:       getDurationEnv("OIDC_TOKEN_TTL", time.Hour),
+		},
+		APITokens: APITokenConfig{
+			Enabled:        getBoolEnv("API_TOKENS_ENABLED", false),
+			Issuer:         getEnv("API_TOKEN_ISSUER", fmt.Sprintf("http://%s:%s", getEnv("SERVER_HOST", "localhost"), getEnv("SERVER_PORT", "8080"))),
+			Audience:       getEnv("API_TOKEN_AUDIENCE", "saml-poc-api"),
+			TTL:            getDurationEnv("API_TOKEN_TTL", 15*time.Minute),
+			RolesClaim:     getEnv("API_TOKEN_ROLES_CLAIM", "roles"),
+			SigningKeyFile: getEnv("API_TOKEN_SIGNING_KEY_FILE", getEnv("SAML_KEY_FILE", "sp.key")),
+		},
+		UI: UIConfig{
+			TemplateDir:  getEnv("UI_TEMPLATE_DIR", ""),
+			BrandName:    getEnv("UI_BRAND_NAME", "SAML SSO"),
+			LogoURL:      getEnv("UI_LOGO_URL", ""),
+			PrimaryColor: getEnv("UI_PRIMARY_COLOR", "#3498db"),
+		},
+		Debug: DebugConfig{
+			Enabled:         getBoolEnv("DEBUG_ENABLED", false),
+			DevMode:         getBoolEnv("DEV_MODE", false),
+			DiagnosticsSize: getIntEnv("SAML_DIAGNOSTICS_SIZE", 20),
+			TraceSize:       getIntEnv("SAML_TRACE_SIZE", 20),
+		},
+		AuthCache: AuthCacheConfig{
+			TTL:        getDurationEnv("AUTH_CACHE_TTL", 30*time.Second),
+			MaxEntries: getIntEnv("AUTH_CACHE_MAX_ENTRIES", 10000),
+		},
+	}
+
+	if err := loadJITPolicy(&cfg.JIT.Policy); err != nil {
+		return nil, err
+	}
+
+	// Docker/Kubernetes secrets are mounted as files; prefer them over plain env vars
+	if passwordFile := os.Getenv("DB_PASSWORD_FILE"); passwordFile != "" {
+		password, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DB_PASSWORD_FILE: %w", err)
+		}
+		cfg.Database.Password = strings.TrimRight(string(password), "\r\n")
+	}
+
+	if tokenFile := os.Getenv("SCIM_TOKEN_FILE"); tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SCIM_TOKEN_FILE: %w", err)
+		}
+		cfg.SCIM.Token = strings.TrimSpace(string(token))
+	}
+
+	if secretFile := os.Getenv("PROXY_HEADER_SECRET_FILE"); secretFile != "" {
+		secret, err := os.ReadFile(secretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PROXY_HEADER_SECRET_FILE: %w", err)
+		}
+		cfg.Proxy.HeaderSecret = strings.TrimSpace(string(secret))
+	}
+
+	networks, err := parseNetworks(getEnv("DEBUG_ALLOWED_IPS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DEBUG_ALLOWED_IPS: %w", err)
+	}
+	cfg.Debug.AllowedNetworks = networks
+
+	if err := loadRoutes(cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Proxy.Routes) > 0 && cfg.Proxy.HeaderSecret == "" {
+		return nil, fmt.Errorf("PROXY_HEADER_SECRET is required when proxy routes are configured")
+	}
+	if cfg.ForwardAuth.Enabled && cfg.Proxy.HeaderSecret == "" {
+		return nil, fmt.Errorf("PROXY_HEADER_SECRET is required when FORWARD_AUTH_ENABLED is set")
+	}
+
+	if len(cfg.SAML.RedirectPaths) == 0 {
+		cfg.SAML.RedirectPaths = []string{"/"}
+	}
+	for _, path := range append(cfg.SAML.RedirectPaths, cfg.SAML.DefaultRedirect) {
+		if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+			return nil, fmt.Errorf("invalid redirect path %q: must start with a single /", path)
+		}
+	}
+
+	if err := loadOIDCClients(&cfg.OIDC); err != nil {
+		return nil, err
+	}
+
+	if !colorPattern.MatchString(cfg.UI.PrimaryColor) {
+		return nil, fmt.Errorf("invalid UI_PRIMARY_COLOR %q: must be a hex colour such as #3498db", cfg.UI.PrimaryColor)
+	}
+
+	switch cfg.APITokens.RolesClaim {
+	case "", "iss", "aud", "sub", "iat", "exp", "nbf", "email", "name", "token_use":
+		return nil, fmt.Errorf("invalid API_TOKEN_ROLES_CLAIM %q: must not be empty or a reserved claim", cfg.APITokens.RolesClaim)
+	}
+
+	switch cfg.Database.Driver {
+	case "postgres", "sqlite", "memory":
+	default:
+		return nil, fmt.Errorf("invalid DB_DRIVER %q: must be postgres, sqlite or memory", cfg.Database.Driver)
+	}
+
+	if cfg.Database.QueryTimeout <= 0 {
+		return nil, fmt.Errorf("invalid DB_QUERY_TIMEOUT %s: must be positive", cfg.Database.QueryTimeout)
+	}
+	if cfg.Database.MaxOpenConns < 0 {
+		return nil, fmt.Errorf("invalid DB_MAX_OPEN_CONNS %d: must not be negative", cfg.Database.MaxOpenConns)
+	}
+	if cfg.Database.MaxIdleConns < 0 {
+		return nil, fmt.Errorf("invalid DB_MAX_IDLE_CONNS %d: must not be negative", cfg.Database.MaxIdleConns)
 	}
 
 	return cfg, nil
 }
 
-// DatabaseConnectionString returns the database connection string
+// loadOIDCClients reads the relying parties from the JSON file in OIDC_CLIENTS_FILE
+func loadOIDCClients(oidc *OIDCConfig) error {
+	path := os.Getenv("OIDC_CLIENTS_FILE")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read OIDC_CLIENTS_FILE: %w", err)
+	}
+	if err := json.Unmarshal(data, &oidc.Clients); err != nil {
+		return fmt.Errorf("failed to parse OIDC_CLIENTS_FILE: %w", err)
+	}
+
+	oidc.Issuer = strings.TrimSuffix(oidc.Issuer, "/")
+	for i, client := range oidc.Clients {
+		if client.ID == "" || len(client.RedirectURIs) == 0 {
+			return fmt.Errorf("OIDC client %d needs a client_id and at least one redirect_uri", i+1)
+		}
+		for _, uri := range client.RedirectURIs {
+			if parsed, err := url.Parse(uri); err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+				return fmt.Errorf("invalid redirect_uri %q for OIDC client %s", uri, client.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// loadRoutes builds the route table from the built-in pages, PROXY_ROUTES and
+// the JSON file in ROUTES_FILE, in increasing order of precedence
+func loadRoutes(cfg *Config) error {
+	routes := append([]Route(nil), defaultRoutes...)
+	if cfg.Debug.Enabled {
+		routes = append(routes, debugRoute)
+	}
+
+	proxyRoutes, err := parseProxyRoutes(os.Getenv("PROXY_ROUTES"))
+	if err != nil {
+		return err
+	}
+	for _, r := range proxyRoutes {
+		routes = mergeRoute(routes, Route{Path: r.Prefix, Access: RouteAccessAuthenticated, Proxy: r.Target})
+	}
+
+	if path := os.Getenv("ROUTES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read ROUTES_FILE: %w", err)
+		}
+		var fileRoutes []Route
+		if err := json.Unmarshal(data, &fileRoutes); err != nil {
+			return fmt.Errorf("failed to parse ROUTES_FILE: %w", err)
+		}
+		for _, r := range fileRoutes {
+			routes = mergeRoute(routes, r)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := range routes {
+		if err := validateRoute(&routes[i]); err != nil {
+			return err
+		}
+		if seen[routes[i].Path] {
+			return fmt.Errorf("duplicate route for %s", routes[i].Path)
+		}
+		seen[routes[i].Path] = true
+		if routes[i].Handler == debugRoute.Handler && !cfg.Debug.Enabled {
+			return fmt.Errorf("route %s serves the debug page, which requires DEBUG_ENABLED", routes[i].Path)
+		}
+		if routes[i].Proxy != "" {
+			cfg.Proxy.Routes = append(cfg.Proxy.Routes, ProxyRoute{Prefix: routes[i].Path, Target: routes[i].Proxy})
+		}
+	}
+
+	cfg.Routes = routes
+	return nil
+}
+
+// mergeRoute adds a route, replacing any route with the same path
+func mergeRoute(routes []Route, route Route) []Route {
+	for i := range routes {
+		if routes[i].Path == route.Path {
+			routes[i] = route
+			return routes
+		}
+	}
+	return append(routes, route)
+}
+
+// validateRoute checks a route table entry and fills in defaults
+func validateRoute(route *Route) error {
+	if !strings.HasPrefix(route.Path, "/") {
+		return fmt.Errorf("invalid route path %q: must start with /", route.Path)
+	}
+
+	targets := 0
+	for _, target := range []string{route.Handler, route.Static, route.Proxy} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("route %s must set exactly one of handler, static or proxy", route.Path)
+	}
+
+	// Static directories and upstreams serve a subtree
+	if (route.Static != "" || route.Proxy != "") && !strings.HasSuffix(route.Path, "/") {
+		route.Path += "/"
+	}
+
+	switch route.Access {
+	case "":
+		route.Access = RouteAccessAuthenticated
+	case RouteAccessPublic:
+		if len(route.Roles) > 0 {
+			return fmt.Errorf("route %s: a public route cannot require roles", route.Path)
+		}
+	case RouteAccessAuthenticated:
+	default:
+		return fmt.Errorf("route %s: invalid access %q: must be public or authenticated", route.Path, route.Access)
+	}
+
+	if route.Proxy != "" && route.Access == RouteAccessPublic {
+		return fmt.Errorf("route %s: proxy routes must be authenticated to sign identity headers", route.Path)
+	}
+	return nil
+}
+
+// parseProxyRoutes parses PROXY_ROUTES, a comma-separated list of prefix=upstream
+// pairs such as "/grafana/=http://grafana:3000/,/wiki/=http://wiki:8080/"
+func parseProxyRoutes(value string) ([]ProxyRoute, error) {
+	var routes []ProxyRoute
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		prefix, target, ok := strings.Cut(entry, "=")
+		prefix, target = strings.TrimSpace(prefix), strings.TrimSpace(target)
+		if !ok || !strings.HasPrefix(prefix, "/") || target == "" {
+			return nil, fmt.Errorf("invalid PROXY_ROUTES entry %q: expected /prefix/=http://upstream", entry)
+		}
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+
+		routes = append(routes, ProxyRoute{Prefix: prefix, Target: target})
+	}
+	return routes, nil
+}
+
+// loadJITPolicy loads JIT provisioning rules from JIT_POLICY_FILE (JSON) and
+// merges the JIT_ALLOWED_DOMAINS / JIT_BLOCKED_DOMAINS shortcuts
+func loadJITPolicy(policy *JITPolicy) error {
+	if path := os.Getenv("JIT_POLICY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read JIT_POLICY_FILE: %w", err)
+		}
+		if err := json.Unmarshal(data, policy); err != nil {
+			return fmt.Errorf("failed to parse JIT_POLICY_FILE: %w", err)
+		}
+	}
+
+	policy.AllowedDomains = append(policy.AllowedDomains, getListEnv("JIT_ALLOWED_DOMAINS")...)
+	policy.BlockedDomains = append(policy.BlockedDomains, getListEnv("JIT_BLOCKED_DOMAINS")...)
+
+	validOutcome := func(outcome string) bool {
+		switch outcome {
+		case JITOutcomeCreateActive, JITOutcomeCreatePending, JITOutcomeDeny:
+			return true
+		}
+		return false
+	}
+
+	if policy.DefaultOutcome != "" && !validOutcome(policy.DefaultOutcome) {
+		return fmt.Errorf("invalid JIT policy default_outcome %q", policy.DefaultOutcome)
+	}
+	for i, rule := range policy.Rules {
+		if !validOutcome(rule.Outcome) {
+			return fmt.Errorf("invalid outcome %q in JIT policy rule %d (%s)", rule.Outcome, i+1, rule.Name)
+		}
+	}
+
+	return nil
+}
+
+// DatabaseConnectionString returns the database connection string for the configured driver
 func (c *Config) DatabaseConnectionString() string {
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		c.Database.Host,
-		c.Database.Port,
-		c.Database.User,
-		c.Database.Password,
-		c.Database.DBName,
-		c.Database.SSLMode,
-	)
+	if c.Database.Driver == "sqlite" {
+		return c.Database.SQLitePath
+	}
+	if c.Database.URL != "" {
+		return c.Database.URL
+	}
+
+	// Build a URL rather than a key/value DSN so credentials are escaped properly
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.Database.User, c.Database.Password),
+		Host:     net.JoinHostPort(c.Database.Host, c.Database.Port),
+		Path:     "/" + c.Database.DBName,
+		RawQuery: url.Values{"sslmode": {c.Database.SSLMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// IsAdmin reports whether the email belongs to a configured administrator
+func (c *Config) IsAdmin(email string) bool {
+	for _, admin := range c.Admin.Emails {
+		if strings.EqualFold(strings.TrimSpace(admin), strings.TrimSpace(email)) {
+			return true
+		}
+	}
+	return false
 }
 
 // ServerAddress returns the server address
@@ -95,6 +698,31 @@ func (c *Config) ServerAddress() string {
 	return fmt.Sprintf("%s:%s", c.Server.Host, c.Server.Port)
 }
 
+// parseNetworks parses a comma-separated list of IP addresses and CIDR ranges
+func parseNetworks(value string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			network, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			networks = append(networks, network.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return networks, nil
+}
+
 // getEnv gets an environment variable with a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -112,3 +740,34 @@ func getBoolEnv(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+// getListEnv gets a comma-separated list environment variable, skipping empty items
+func getListEnv(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getIntEnv gets an integer environment variable with a default value
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getDurationEnv gets a duration environment variable (e.g. "5s", "250ms") with a default value
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// APIKeyRepository handles API key database operations against PostgreSQL or SQLite
+type APIKeyRepository struct {
+	db *DB
+}
+
+var _ APIKeyStore = (*APIKeyRepository)(nil)
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// apiKeyColumns is the column list read by scanAPIKey
+const apiKeyColumns = `id, user_id, name, hint, scopes, expires_at, last_used_at, created_at`
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	var scopes string
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Hint,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = models.SplitScopes(scopes)
+	return key, nil
+}
+
+// CreateAPIKey stores a new API key
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, key_hash, hint, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		RETURNING id, created_at
+	`
+
+	err := r.db.conn.QueryRowContext(ctx, query,
+		key.UserID, key.Name, keyHash, key.Hint, models.JoinScopes(key.Scopes), key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// ListAPIKeys returns a user's API keys, newest first
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = $1 ORDER BY id DESC`
+
+	rows, err := r.db.conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (r *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	key, err := scanAPIKey(r.db.conn.QueryRowContext(ctx, query, keyHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Key not found
+		}
+		return nil, fmt.Errorf("failed to query API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// DeleteAPIKey deletes one of a user's API keys
+func (r *APIKeyRepository) DeleteAPIKey(ctx context.Context, userID, id int) (bool, error) {
+	query := `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`
+
+	result, err := r.db.conn.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete API key: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return deleted > 0, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id int, usedAt time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`
+
+	if _, err := r.db.conn.ExecContext(ctx, query, usedAt, id); err != nil {
+		return fmt.Errorf("failed to update API key last use: %w", err)
+	}
+
+	return nil
+}
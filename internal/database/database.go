@@ -1,31 +1,104 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"embed"
 	"fmt"
+	"io/fs"
 	"log"
+	"sort"
+	"time"
 
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
+// Supported database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
 // DB wraps the database connection
 type DB struct {
-	conn *sql.DB
+	conn   *sql.DB
+	driver string
 }
 
-// New creates a new database connection
-func New(connectionString string) (*DB, error) {
-	conn, err := sql.Open("postgres", connectionString)
+// maxRetryBackoff caps the exponential backoff between connection attempts
+const maxRetryBackoff = 30 * time.Second
+
+// Options holds connection pool and startup retry settings
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectRetries is the number of additional ping attempts made while the database is unavailable
+	ConnectRetries int
+	RetryBackoff   time.Duration
+
+	// SkipMigrations disables automatic SQLite migrations (used by maintenance tools
+	// that must run before a pending migration can succeed)
+	SkipMigrations bool
+}
+
+// New creates a new database connection for the given driver
+func New(driver, dataSource string, opts Options) (*DB, error) {
+	if driver != DriverPostgres && driver != DriverSQLite {
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+
+	conn, err := sql.Open(driver, dataSource)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	if err := conn.Ping(); err != nil {
+	if driver == DriverSQLite {
+		// SQLite only allows a single writer; serialize access through one long-lived connection
+		conn.SetMaxOpenConns(1)
+	} else {
+		conn.SetMaxOpenConns(opts.MaxOpenConns)
+		conn.SetMaxIdleConns(opts.MaxIdleConns)
+		conn.SetConnMaxLifetime(opts.ConnMaxLifetime)
+		conn.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+
+	if err := pingWithRetry(conn, opts); err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	db := &DB{conn: conn, driver: driver}
+
+	if driver == DriverSQLite {
+		// SQLite ignores REFERENCES ... ON DELETE CASCADE unless foreign keys are enabled
+		if _, err := conn.Exec(`PRAGMA foreign_keys = ON`); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+		}
+	}
+
+	if driver == DriverSQLite && !opts.SkipMigrations {
+		if err := db.migrateSQLite(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if driver == DriverSQLite {
+		log.Printf("Successfully opened SQLite database: %s", dataSource)
+		return db, nil
+	}
+
 	log.Println("Successfully connected to PostgreSQL database")
-	return &DB{conn: conn}, nil
+	return db, nil
 }
 
 // Close closes the database connection
@@ -41,7 +114,112 @@ func (db *DB) GetConnection() *sql.DB {
 	return db.conn
 }
 
+// Driver returns the name of the database driver in use
+func (db *DB) Driver() string {
+	return db.driver
+}
+
 // Health checks if the database connection is healthy
 func (db *DB) Health() error {
 	return db.conn.Ping()
 }
+
+// tableExists reports whether a table exists in the connected database
+func (db *DB) tableExists(ctx context.Context, table string) (bool, error) {
+	query := `SELECT to_regclass($1) IS NOT NULL`
+	if db.driver == DriverSQLite {
+		query = `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = $1`
+	}
+
+	var exists bool
+	if err := db.conn.QueryRowContext(ctx, query, table).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check for table %s: %w", table, err)
+	}
+
+	return exists, nil
+}
+
+// pingWithRetry pings the database, retrying with exponential backoff while it is still starting up
+func pingWithRetry(conn *sql.DB, opts Options) error {
+	backoff := opts.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	var err error
+	for attempt := 0; attempt <= opts.ConnectRetries; attempt++ {
+		if err = conn.Ping(); err == nil {
+			return nil
+		}
+		if attempt == opts.ConnectRetries {
+			break
+		}
+
+		log.Printf("Database not ready (attempt %d/%d): %v; retrying in %s",
+			attempt+1, opts.ConnectRetries+1, err, backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+
+	return err
+}
+
+// sqliteMigrationChecks run before the migration they are keyed by. SQLite
+// scripts cannot report a problem themselves the way the PostgreSQL DO blocks do.
+var sqliteMigrationChecks = map[string]func(db *DB) error{
+	"migrations/sqlite/002_normalize_emails.sql": checkEmailDuplicates,
+}
+
+// migrateSQLite applies embedded SQLite migrations that have not been applied yet.
+// PostgreSQL migrations are applied by the container init scripts instead.
+func (db *DB) migrateSQLite() error {
+	if _, err := db.conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version TEXT PRIMARY KEY,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	files, err := fs.Glob(sqliteMigrations, "migrations/sqlite/*.sql")
+	if err != nil {
+		return fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		var applied int
+		if err := db.conn.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, file).Scan(&applied); err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", file, err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		if check := sqliteMigrationChecks[file]; check != nil {
+			if err := check(db); err != nil {
+				return fmt.Errorf("cannot apply migration %s: %w", file, err)
+			}
+		}
+
+		script, err := sqliteMigrations.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+
+		if _, err := db.conn.Exec(string(script)); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", file, err)
+		}
+
+		if _, err := db.conn.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, file); err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", file, err)
+		}
+
+		log.Printf("Applied SQLite migration: %s", file)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"saml-poc/internal/models"
+)
+
+// EmailDuplicate groups accounts whose emails differ only by case or surrounding whitespace
+type EmailDuplicate struct {
+	NormalizedEmail string
+	Users           []*models.User // oldest first
+}
+
+// FindEmailDuplicates returns all groups of case-duplicate accounts.
+// Only columns present since the initial schema are loaded, so it works on any schema version.
+func (r *UserRepository) FindEmailDuplicates(ctx context.Context) ([]EmailDuplicate, error) {
+	query := `
+		SELECT id, email, first_name, last_name, created_at, updated_at
+		FROM users
+		WHERE LOWER(TRIM(email)) IN (
+			SELECT LOWER(TRIM(email)) FROM users
+			GROUP BY LOWER(TRIM(email))
+			HAVING COUNT(*) > 1
+		)
+		ORDER BY LOWER(TRIM(email)), created_at, id
+	`
+
+	rows, err := r.db.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query duplicate users: %w", err)
+	}
+	defer rows.Close()
+
+	var duplicates []EmailDuplicate
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+
+		normalized := models.NormalizeEmail(user.Email)
+		if n := len(duplicates); n == 0 || duplicates[n-1].NormalizedEmail != normalized {
+			duplicates = append(duplicates, EmailDuplicate{NormalizedEmail: normalized})
+		}
+		last := &duplicates[len(duplicates)-1]
+		last.Users = append(last.Users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate duplicate users: %w", err)
+	}
+
+	return duplicates, nil
+}
+
+// mergeMoves re-point rows referencing a merged account to the kept one, keyed by
+// table. Without them the ON DELETE CASCADE foreign keys would silently drop the
+// merged accounts' identities, group memberships and API keys.
+var mergeMoves = []struct {
+	table string
+	query string
+}{
+	{"user_identities", `UPDATE user_identities SET user_id = $1 WHERE user_id = $2`},
+	{"group_members", `INSERT INTO group_members (group_id, user_id) SELECT group_id, $1 FROM group_members WHERE user_id = $2 ON CONFLICT DO NOTHING`},
+	{"api_keys", `UPDATE api_keys SET user_id = $1 WHERE user_id = $2`},
+}
+
+// checkEmailDuplicates logs every group of case-duplicate accounts and fails if
+// there are any, since the unique email index cannot be created until they are merged
+func checkEmailDuplicates(db *DB) error {
+	duplicates, err := NewUserRepository(db).FindEmailDuplicates(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, dup := range duplicates {
+		accounts := make([]string, len(dup.Users))
+		for i, user := range dup.Users {
+			accounts[i] = fmt.Sprintf("%s (id %d)", user.Email, user.ID)
+		}
+		log.Printf("Case-duplicate accounts for %s: %s", dup.NormalizedEmail, strings.Join(accounts, ", "))
+	}
+
+	if len(duplicates) > 0 {
+		return fmt.Errorf(`%d email(s) have case-duplicate accounts; run "go run ./cmd/dedupe-emails" and restart`, len(duplicates))
+	}
+	return nil
+}
+
+// MergeUsers folds duplicate accounts into keepID: linked identities, group memberships
+// and API keys move to the kept account, the duplicates are removed and the kept
+// account's email is normalized, all in one transaction
+func (r *UserRepository) MergeUsers(ctx context.Context, keepID int, duplicateIDs []int) error {
+	// The tool may run before later migrations created these tables. Check before
+	// the transaction takes SQLite's only connection.
+	moves := mergeMoves[:0:0]
+	for _, move := range mergeMoves {
+		exists, err := r.db.tableExists(ctx, move.table)
+		if err != nil {
+			return err
+		}
+		if exists {
+			moves = append(moves, move)
+		}
+	}
+
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin merge transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range duplicateIDs {
+		if id == keepID {
+			continue
+		}
+		for _, move := range moves {
+			if _, err := tx.ExecContext(ctx, move.query, keepID, id); err != nil {
+				return fmt.Errorf("failed to move %s of user %d: %w", move.table, id, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("failed to remove duplicate user %d: %w", id, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE users SET email = LOWER(TRIM(email)), updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		keepID,
+	); err != nil {
+		return fmt.Errorf("failed to normalize kept user %d: %w", keepID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	log.Printf("Merged users %v into user %d", duplicateIDs, keepID)
+	return nil
+}
+
+// NormalizeEmails lowercases all stored emails and creates the case-insensitive unique index.
+// It fails if case-duplicate accounts remain.
+func (r *UserRepository) NormalizeEmails(ctx context.Context) error {
+	statements := []string{
+		`UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email))`,
+		`DROP INDEX IF EXISTS idx_users_email`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))`,
+	}
+
+	for _, statement := range statements {
+		if _, err := r.db.conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to normalize emails: %w", err)
+		}
+	}
+
+	return nil
+}
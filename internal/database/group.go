@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"saml-poc/internal/models"
+)
+
+// GroupRepository handles group database operations against PostgreSQL or SQLite
+type GroupRepository struct {
+	db *DB
+}
+
+var _ GroupStore = (*GroupRepository)(nil)
+
+// NewGroupRepository creates a new group repository
+func NewGroupRepository(db *DB) *GroupRepository {
+	return &GroupRepository{db: db}
+}
+
+// GetGroup retrieves a group with its members by ID
+func (r *GroupRepository) GetGroup(ctx context.Context, id int) (*models.Group, error) {
+	query := `SELECT id, display_name, created_at, updated_at FROM groups WHERE id = $1`
+	return r.getGroup(ctx, query, id)
+}
+
+// GetGroupByName retrieves a group with its members by display name
+func (r *GroupRepository) GetGroupByName(ctx context.Context, displayName string) (*models.Group, error) {
+	query := `SELECT id, display_name, created_at, updated_at FROM groups WHERE display_name = $1`
+	return r.getGroup(ctx, query, displayName)
+}
+
+// getGroup loads a single group and its members
+func (r *GroupRepository) getGroup(ctx context.Context, query string, arg interface{}) (*models.Group, error) {
+	group := &models.Group{}
+	err := r.db.conn.QueryRowContext(ctx, query, arg).Scan(
+		&group.ID,
+		&group.DisplayName,
+		&group.CreatedAt,
+		&group.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Group not found
+		}
+		return nil, fmt.Errorf("failed to query group: %w", err)
+	}
+
+	if err := r.loadMembers(ctx, []*models.Group{group}); err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// ListGroups returns groups with their members with pagination
+func (r *GroupRepository) ListGroups(ctx context.Context, limit, offset int) ([]*models.Group, error) {
+	query := `
+		SELECT id, display_name, created_at, updated_at
+		FROM groups
+		ORDER BY id
+		LIMIT $1 OFFSET $2
+	`
+
+	groups, err := r.queryGroups(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadMembers(ctx, groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// ListUserGroups returns the groups a user belongs to
+func (r *GroupRepository) ListUserGroups(ctx context.Context, userID int) ([]*models.Group, error) {
+	query := `
+		SELECT g.id, g.display_name, g.created_at, g.updated_at
+		FROM groups g
+		JOIN group_members m ON m.group_id = g.id
+		WHERE m.user_id = $1
+		ORDER BY g.display_name
+	`
+
+	return r.queryGroups(ctx, query, userID)
+}
+
+// CreateGroup creates a new group with the given members
+func (r *GroupRepository) CreateGroup(ctx context.Context, displayName string, memberIDs []int) (*models.Group, error) {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO groups (display_name, created_at, updated_at)
+		VALUES ($1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id, display_name, created_at, updated_at
+	`
+
+	group := &models.Group{}
+	err = tx.QueryRowContext(ctx, query, displayName).Scan(
+		&group.ID,
+		&group.DisplayName,
+		&group.CreatedAt,
+		&group.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+
+	if err := insertMembers(ctx, tx, group.ID, memberIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit group: %w", err)
+	}
+
+	group.MemberIDs = append([]int(nil), memberIDs...)
+	log.Printf("Successfully created group: %s (%d members)", group.DisplayName, len(memberIDs))
+	return group, nil
+}
+
+// RenameGroup changes a group's display name
+func (r *GroupRepository) RenameGroup(ctx context.Context, id int, displayName string) error {
+	query := `UPDATE groups SET display_name = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	if _, err := r.db.conn.ExecContext(ctx, query, id, displayName); err != nil {
+		return fmt.Errorf("failed to rename group: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteGroup deletes a group and its memberships
+func (r *GroupRepository) DeleteGroup(ctx context.Context, id int) error {
+	if _, err := r.db.conn.ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+
+	return nil
+}
+
+// AddGroupMembers adds users to a group
+func (r *GroupRepository) AddGroupMembers(ctx context.Context, groupID int, userIDs []int) error {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertMembers(ctx, tx, groupID, userIDs); err != nil {
+		return err
+	}
+
+	if err := touchGroup(ctx, tx, groupID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveGroupMembers removes users from a group
+func (r *GroupRepository) RemoveGroupMembers(ctx context.Context, groupID int, userIDs []int) error {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, userID := range userIDs {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM group_members WHERE group_id = $1 AND user_id = $2`, groupID, userID,
+		); err != nil {
+			return fmt.Errorf("failed to remove group member: %w", err)
+		}
+	}
+
+	if err := touchGroup(ctx, tx, groupID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetGroupMembers replaces a group's members
+func (r *GroupRepository) SetGroupMembers(ctx context.Context, groupID int, userIDs []int) error {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = $1`, groupID); err != nil {
+		return fmt.Errorf("failed to clear group members: %w", err)
+	}
+
+	if err := insertMembers(ctx, tx, groupID, userIDs); err != nil {
+		return err
+	}
+
+	if err := touchGroup(ctx, tx, groupID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// queryGroups runs a query selecting group rows (without members)
+func (r *GroupRepository) queryGroups(ctx context.Context, query string, args ...interface{}) ([]*models.Group, error) {
+	rows, err := r.db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []*models.Group
+	for rows.Next() {
+		group := &models.Group{}
+		err := rows.Scan(
+			&group.ID,
+			&group.DisplayName,
+			&group.CreatedAt,
+			&group.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate groups: %w", err)
+	}
+
+	return groups, nil
+}
+
+// loadMembers fills MemberIDs for the given groups with a single query
+func (r *GroupRepository) loadMembers(ctx context.Context, groups []*models.Group) error {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Group, len(groups))
+	placeholders := make([]string, len(groups))
+	args := make([]interface{}, len(groups))
+	for i, group := range groups {
+		byID[group.ID] = group
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = group.ID
+	}
+
+	query := `SELECT group_id, user_id FROM group_members WHERE group_id IN (` +
+		strings.Join(placeholders, ", ") + `) ORDER BY user_id`
+
+	rows, err := r.db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query group members: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var groupID, userID int
+		if err := rows.Scan(&groupID, &userID); err != nil {
+			return fmt.Errorf("failed to scan group member: %w", err)
+		}
+		byID[groupID].MemberIDs = append(byID[groupID].MemberIDs, userID)
+	}
+
+	return rows.Err()
+}
+
+// insertMembers adds memberships inside a transaction, ignoring existing ones
+func insertMembers(ctx context.Context, tx *sql.Tx, groupID int, userIDs []int) error {
+	for _, userID := range userIDs {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO group_members (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			groupID, userID,
+		); err != nil {
+			return fmt.Errorf("failed to add group member: %w", err)
+		}
+	}
+	return nil
+}
+
+// touchGroup bumps a group's updated_at after a membership change
+func touchGroup(ctx context.Context, tx *sql.Tx, groupID int) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE groups SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, groupID); err != nil {
+		return fmt.Errorf("failed to update group: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"saml-poc/internal/models"
+)
+
+// GetByIdentity retrieves the user linked to an external identity
+func (r *UserRepository) GetByIdentity(ctx context.Context, idpEntityID, nameIDFormat, nameID string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = (
+			SELECT user_id FROM user_identities
+			WHERE idp_entity_id = $1 AND name_id_format = $2 AND name_id = $3
+		)
+	`
+
+	user, err := scanUser(r.db.conn.QueryRowContext(ctx, query, idpEntityID, nameIDFormat, nameID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Identity not linked
+		}
+		return nil, fmt.Errorf("failed to query user by identity: %w", err)
+	}
+
+	return user, nil
+}
+
+// LinkIdentity links an external identity to a user
+func (r *UserRepository) LinkIdentity(ctx context.Context, userID int, idpEntityID, nameIDFormat, nameID string) error {
+	query := `
+		INSERT INTO user_identities (user_id, idp_entity_id, name_id_format, name_id, created_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (idp_entity_id, name_id_format, name_id) DO NOTHING
+	`
+
+	result, err := r.db.conn.ExecContext(ctx, query, userID, idpEntityID, nameIDFormat, nameID)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	if linked, err := result.RowsAffected(); err == nil && linked > 0 {
+		log.Printf("Linked identity %s (%s) from %s to user %d", nameID, nameIDFormat, idpEntityID, userID)
+	}
+
+	return nil
+}
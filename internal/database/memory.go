@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// MemoryUserStore is an in-memory UserStore for tests and small deployments.
+// Data is lost when the process exits.
+type MemoryUserStore struct {
+	mu         sync.RWMutex
+	users      map[int]*models.User
+	identities map[identityKey]int // identity -> user ID
+	nextID     int
+}
+
+// identityKey identifies an external identity in the memory store
+type identityKey struct {
+	idpEntityID  string
+	nameIDFormat string
+	nameID       string
+}
+
+var _ UserStore = (*MemoryUserStore)(nil)
+
+// NewMemoryUserStore creates a new in-memory user store
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users:      make(map[int]*models.User),
+		identities: make(map[identityKey]int),
+		nextID:     1,
+	}
+}
+
+// GetByEmail retrieves a user by email address
+func (s *MemoryUserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	email = models.NormalizeEmail(email)
+	for _, user := range s.users {
+		if user.Email == email {
+			return copyUser(user), nil
+		}
+	}
+
+	return nil, nil // User not found
+}
+
+// GetByID retrieves a user by ID
+func (s *MemoryUserStore) GetByID(ctx context.Context, id int) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if user, ok := s.users[id]; ok {
+		return copyUser(user), nil
+	}
+
+	return nil, nil // User not found
+}
+
+// Create creates a new user in the store
+func (s *MemoryUserStore) Create(ctx context.Context, email, firstName, lastName, status string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email = models.NormalizeEmail(email)
+	for _, existing := range s.users {
+		if existing.Email == email {
+			return nil, fmt.Errorf("failed to create user: email %s already exists", email)
+		}
+	}
+
+	return s.insert(email, firstName, lastName, status), nil
+}
+
+// insert adds a new user; the caller must hold the write lock and have checked the email is free
+func (s *MemoryUserStore) insert(email, firstName, lastName, status string) *models.User {
+	now := time.Now().UTC()
+	user := &models.User{
+		ID:        s.nextID,
+		Email:     email,
+		FirstName: firstName,
+		LastName:  lastName,
+		Status:    status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.users[user.ID] = user
+	s.nextID++
+
+	log.Printf("Successfully created new user: %s (%s %s, %s)", user.Email, user.FirstName, user.LastName, user.Status)
+	return copyUser(user)
+}
+
+// GetOrCreate creates a user unless one with the same email exists
+func (s *MemoryUserStore) GetOrCreate(ctx context.Context, email, firstName, lastName, status string) (*models.User, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email = models.NormalizeEmail(email)
+	for _, existing := range s.users {
+		if existing.Email == email {
+			return copyUser(existing), false, nil
+		}
+	}
+
+	return s.insert(email, firstName, lastName, status), true, nil
+}
+
+// Update updates an existing user, including an email change (stored normalized)
+func (s *MemoryUserStore) Update(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.users[user.ID]
+	if !ok {
+		return nil
+	}
+
+	user.Email = models.NormalizeEmail(user.Email)
+	for id, other := range s.users {
+		if id != user.ID && other.Email == user.Email {
+			return fmt.Errorf("failed to update user: email %s already exists", user.Email)
+		}
+	}
+
+	existing.Email = user.Email
+	existing.FirstName = user.FirstName
+	existing.LastName = user.LastName
+	if !user.IsSuspended() {
+		user.SuspensionReason = ""
+	}
+
+	existing.Status = user.Status
+	existing.SuspensionReason = user.SuspensionReason
+	existing.AccessExpiresAt = copyTime(user.AccessExpiresAt)
+	existing.UpdatedAt = time.Now().UTC()
+
+	return nil
+}
+
+// Delete soft deletes a user (sets status to deprovisioned)
+func (s *MemoryUserStore) Delete(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.users[id]; ok {
+		existing.Status = models.UserStatusDeprovisioned
+		existing.SuspensionReason = ""
+		existing.UpdatedAt = time.Now().UTC()
+	}
+
+	return nil
+}
+
+// List returns all users with pagination, newest first
+func (s *MemoryUserStore) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make([]*models.User, 0, len(s.users))
+	for _, user := range s.users {
+		all = append(all, copyUser(user))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].CreatedAt.Equal(all[j].CreatedAt) {
+			return all[i].ID > all[j].ID
+		}
+		return all[i].CreatedAt.After(all[j].CreatedAt)
+	})
+
+	return paginate(all, limit, offset), nil
+}
+
+// ListByStatus returns users with the given status with pagination, oldest first
+func (s *MemoryUserStore) ListByStatus(ctx context.Context, status string, limit, offset int) ([]*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matching []*models.User
+	for _, user := range s.users {
+		if user.Status == status {
+			matching = append(matching, copyUser(user))
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		if matching[i].CreatedAt.Equal(matching[j].CreatedAt) {
+			return matching[i].ID < matching[j].ID
+		}
+		return matching[i].CreatedAt.Before(matching[j].CreatedAt)
+	})
+
+	return paginate(matching, limit, offset), nil
+}
+
+// SuspendExpired suspends active users whose access expired at or before now
+func (s *MemoryUserStore) SuspendExpired(ctx context.Context, now time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	suspended := 0
+	for _, user := range s.users {
+		if user.Status == models.UserStatusActive && user.IsExpired(now) {
+			user.Suspend(models.SuspensionReasonExpired)
+			user.UpdatedAt = time.Now().UTC()
+			suspended++
+		}
+	}
+
+	return suspended, nil
+}
+
+// paginate returns the limit/offset window of users
+func paginate(users []*models.User, limit, offset int) []*models.User {
+	if offset >= len(users) {
+		return nil
+	}
+	end := offset + limit
+	if end > len(users) {
+		end = len(users)
+	}
+	return users[offset:end]
+}
+
+// GetByIdentity retrieves the user linked to an external identity
+func (s *MemoryUserStore) GetByIdentity(ctx context.Context, idpEntityID, nameIDFormat, nameID string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userID, ok := s.identities[identityKey{idpEntityID, nameIDFormat, nameID}]
+	if !ok {
+		return nil, nil // Identity not linked
+	}
+
+	return copyUser(s.users[userID]), nil
+}
+
+// LinkIdentity links an external identity to a user
+func (s *MemoryUserStore) LinkIdentity(ctx context.Context, userID int, idpEntityID, nameIDFormat, nameID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("failed to link identity: user %d not found", userID)
+	}
+
+	key := identityKey{idpEntityID, nameIDFormat, nameID}
+	if _, ok := s.identities[key]; !ok {
+		s.identities[key] = userID
+		log.Printf("Linked identity %s (%s) from %s to user %d", nameID, nameIDFormat, idpEntityID, userID)
+	}
+
+	return nil
+}
+
+// copyUser returns a copy so callers cannot mutate stored records
+func copyUser(user *models.User) *models.User {
+	c := *user
+	c.AccessExpiresAt = copyTime(user.AccessExpiresAt)
+	return &c
+}
+
+// copyTime returns a copy of an optional time
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
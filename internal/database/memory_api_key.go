@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// MemoryAPIKeyStore is an in-memory APIKeyStore for tests and small deployments.
+// Data is lost when the process exits.
+type MemoryAPIKeyStore struct {
+	mu     sync.RWMutex
+	keys   map[int]*models.APIKey
+	hashes map[string]int // key hash -> key ID
+	nextID int
+}
+
+var _ APIKeyStore = (*MemoryAPIKeyStore)(nil)
+
+// NewMemoryAPIKeyStore creates a new in-memory API key store
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{
+		keys:   make(map[int]*models.APIKey),
+		hashes: make(map[string]int),
+		nextID: 1,
+	}
+}
+
+// CreateAPIKey stores a new API key
+func (s *MemoryAPIKeyStore) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.ID = s.nextID
+	key.CreatedAt = time.Now()
+	s.nextID++
+
+	s.keys[key.ID] = copyAPIKey(key)
+	s.hashes[keyHash] = key.ID
+	return nil
+}
+
+// ListAPIKeys returns a user's API keys, newest first
+func (s *MemoryAPIKeyStore) ListAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []*models.APIKey
+	for _, key := range s.keys {
+		if key.UserID == userID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, k int) bool { return keys[i].ID > keys[k].ID })
+	return keys, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (s *MemoryAPIKeyStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.hashes[keyHash]
+	if !ok {
+		return nil, nil
+	}
+	return copyAPIKey(s.keys[id]), nil
+}
+
+// DeleteAPIKey deletes one of a user's API keys
+func (s *MemoryAPIKeyStore) DeleteAPIKey(ctx context.Context, userID, id int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok || key.UserID != userID {
+		return false, nil
+	}
+
+	delete(s.keys, id)
+	for hash, keyID := range s.hashes {
+		if keyID == id {
+			delete(s.hashes, hash)
+		}
+	}
+	return true, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (s *MemoryAPIKeyStore) TouchAPIKey(ctx context.Context, id int, usedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[id]; ok {
+		key.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+// copyAPIKey returns a copy so callers cannot modify stored keys
+func copyAPIKey(key *models.APIKey) *models.APIKey {
+	c := *key
+	c.Scopes = append([]string(nil), key.Scopes...)
+	if key.ExpiresAt != nil {
+		expires := *key.ExpiresAt
+		c.ExpiresAt = &expires
+	}
+	if key.LastUsedAt != nil {
+		used := *key.LastUsedAt
+		c.LastUsedAt = &used
+	}
+	return &c
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// MemoryGroupStore is an in-memory GroupStore used with the memory user store.
+// Data is lost when the process exits.
+type MemoryGroupStore struct {
+	mu      sync.RWMutex
+	groups  map[int]*models.Group
+	members map[int]map[int]bool // group ID -> set of user IDs
+	nextID  int
+}
+
+var _ GroupStore = (*MemoryGroupStore)(nil)
+
+// NewMemoryGroupStore creates a new in-memory group store
+func NewMemoryGroupStore() *MemoryGroupStore {
+	return &MemoryGroupStore{
+		groups:  make(map[int]*models.Group),
+		members: make(map[int]map[int]bool),
+		nextID:  1,
+	}
+}
+
+// GetGroup retrieves a group with its members by ID
+func (s *MemoryGroupStore) GetGroup(ctx context.Context, id int) (*models.Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if group, ok := s.groups[id]; ok {
+		return s.copyGroup(group, true), nil
+	}
+
+	return nil, nil // Group not found
+}
+
+// GetGroupByName retrieves a group with its members by display name
+func (s *MemoryGroupStore) GetGroupByName(ctx context.Context, displayName string) (*models.Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, group := range s.groups {
+		if group.DisplayName == displayName {
+			return s.copyGroup(group, true), nil
+		}
+	}
+
+	return nil, nil // Group not found
+}
+
+// ListGroups returns groups with their members with pagination
+func (s *MemoryGroupStore) ListGroups(ctx context.Context, limit, offset int) ([]*models.Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make([]*models.Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, s.copyGroup(group, true))
+	}
+	sort.Slice(groups, func(i, k int) bool { return groups[i].ID < groups[k].ID })
+
+	if offset >= len(groups) {
+		return nil, nil
+	}
+	groups = groups[offset:]
+	if limit < len(groups) {
+		groups = groups[:limit]
+	}
+	return groups, nil
+}
+
+// ListUserGroups returns the groups a user belongs to
+func (s *MemoryGroupStore) ListUserGroups(ctx context.Context, userID int) ([]*models.Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var groups []*models.Group
+	for id, members := range s.members {
+		if members[userID] {
+			groups = append(groups, s.copyGroup(s.groups[id], false))
+		}
+	}
+	sort.Slice(groups, func(i, k int) bool { return groups[i].DisplayName < groups[k].DisplayName })
+
+	return groups, nil
+}
+
+// CreateGroup creates a new group with the given members
+func (s *MemoryGroupStore) CreateGroup(ctx context.Context, displayName string, memberIDs []int) (*models.Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(displayName, 0) {
+		return nil, fmt.Errorf("failed to create group: display name %s already exists", displayName)
+	}
+
+	now := time.Now()
+	group := &models.Group{
+		ID:          s.nextID,
+		DisplayName: displayName,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.nextID++
+	s.groups[group.ID] = group
+	s.members[group.ID] = make(map[int]bool)
+	for _, userID := range memberIDs {
+		s.members[group.ID][userID] = true
+	}
+
+	log.Printf("Successfully created group: %s (%d members)", group.DisplayName, len(memberIDs))
+	return s.copyGroup(group, true), nil
+}
+
+// RenameGroup changes a group's display name
+func (s *MemoryGroupStore) RenameGroup(ctx context.Context, id int, displayName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[id]
+	if !ok {
+		return nil
+	}
+	if s.nameTaken(displayName, id) {
+		return fmt.Errorf("failed to rename group: display name %s already exists", displayName)
+	}
+
+	group.DisplayName = displayName
+	group.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteGroup deletes a group and its memberships
+func (s *MemoryGroupStore) DeleteGroup(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.groups, id)
+	delete(s.members, id)
+	return nil
+}
+
+// AddGroupMembers adds users to a group
+func (s *MemoryGroupStore) AddGroupMembers(ctx context.Context, groupID int, userIDs []int) error {
+	return s.updateMembers(ctx, groupID, func(members map[int]bool) {
+		for _, userID := range userIDs {
+			members[userID] = true
+		}
+	})
+}
+
+// RemoveGroupMembers removes users from a group
+func (s *MemoryGroupStore) RemoveGroupMembers(ctx context.Context, groupID int, userIDs []int) error {
+	return s.updateMembers(ctx, groupID, func(members map[int]bool) {
+		for _, userID := range userIDs {
+			delete(members, userID)
+		}
+	})
+}
+
+// SetGroupMembers replaces a group's members
+func (s *MemoryGroupStore) SetGroupMembers(ctx context.Context, groupID int, userIDs []int) error {
+	return s.updateMembers(ctx, groupID, func(members map[int]bool) {
+		for userID := range members {
+			delete(members, userID)
+		}
+		for _, userID := range userIDs {
+			members[userID] = true
+		}
+	})
+}
+
+// updateMembers applies a membership change to an existing group
+func (s *MemoryGroupStore) updateMembers(ctx context.Context, groupID int, change func(map[int]bool)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupID]
+	if !ok {
+		return nil
+	}
+
+	change(s.members[groupID])
+	group.UpdatedAt = time.Now()
+	return nil
+}
+
+// nameTaken reports whether another group already uses displayName
+func (s *MemoryGroupStore) nameTaken(displayName string, exceptID int) bool {
+	for id, group := range s.groups {
+		if id != exceptID && group.DisplayName == displayName {
+			return true
+		}
+	}
+	return false
+}
+
+// copyGroup returns a copy of group, optionally with its sorted member IDs
+func (s *MemoryGroupStore) copyGroup(group *models.Group, withMembers bool) *models.Group {
+	copied := *group
+	copied.MemberIDs = nil
+	if withMembers {
+		for userID := range s.members[group.ID] {
+			copied.MemberIDs = append(copied.MemberIDs, userID)
+		}
+		sort.Ints(copied.MemberIDs)
+	}
+	return &copied
+}
@@ -0,0 +1,29 @@
+-- Normalize stored emails (trimmed, lowercased) and enforce case-insensitive uniqueness.
+-- Aborts with a report if case-duplicate accounts exist; merge them first with:
+--   go run ./cmd/dedupe-emails
+DO $$
+DECLARE
+    dup RECORD;
+    dup_count INTEGER := 0;
+BEGIN
+    FOR dup IN
+        SELECT LOWER(TRIM(email)) AS normalized,
+               string_agg(email || ' (id ' || id || ')', ', ' ORDER BY id) AS accounts
+        FROM users
+        GROUP BY LOWER(TRIM(email))
+        HAVING COUNT(*) > 1
+    LOOP
+        RAISE WARNING 'Case-duplicate accounts for %: %', dup.normalized, dup.accounts;
+        dup_count := dup_count + 1;
+    END LOOP;
+
+    IF dup_count > 0 THEN
+        RAISE EXCEPTION '% email(s) have case-duplicate accounts; run "go run ./cmd/dedupe-emails" and re-apply this migration', dup_count;
+    END IF;
+END $$;
+
+UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email));
+
+-- Replace the case-sensitive lookup index with a case-insensitive unique one
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email));
@@ -0,0 +1,10 @@
+-- Richer user lifecycle: suspension reasons and optional access expiry
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspension_reason VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS access_expires_at TIMESTAMP;
+
+-- The inactive status is split into suspended and deprovisioned
+UPDATE users SET status = 'suspended', suspension_reason = 'Deactivated before status migration'
+WHERE status = 'inactive';
+
+-- Create index for the expiry job
+CREATE INDEX IF NOT EXISTS idx_users_access_expires_at ON users(access_expires_at) WHERE access_expires_at IS NOT NULL;
@@ -0,0 +1,9 @@
+-- Normalize stored emails (trimmed, lowercased) and enforce case-insensitive uniqueness.
+-- Not applied while case-duplicate accounts exist: they are logged by
+-- checkEmailDuplicates before this script runs. Merge them first with:
+--   go run ./cmd/dedupe-emails
+UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email));
+
+-- Replace the case-sensitive lookup index with a case-insensitive unique one
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email));
@@ -0,0 +1,14 @@
+-- Link users to stable external identities so accounts survive email changes
+-- and one user can sign in through multiple IdPs
+CREATE TABLE IF NOT EXISTS user_identities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    idp_entity_id VARCHAR(1024) NOT NULL,
+    name_id_format VARCHAR(255) NOT NULL,
+    name_id VARCHAR(1024) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (idp_entity_id, name_id_format, name_id)
+);
+
+-- Create index on user_id for listing a user's identities
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
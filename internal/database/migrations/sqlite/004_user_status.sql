@@ -0,0 +1,9 @@
+-- Replace the is_active flag with an explicit status so JIT users can await approval
+ALTER TABLE users ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active';
+UPDATE users SET status = 'inactive' WHERE is_active = false;
+
+DROP INDEX IF EXISTS idx_users_is_active;
+ALTER TABLE users DROP COLUMN is_active;
+
+-- Create index on status for the approval queue
+CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
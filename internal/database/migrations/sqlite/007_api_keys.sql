@@ -0,0 +1,15 @@
+-- Long-lived API keys users create for automation; only a SHA-256 hash of each key is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    key_hash VARCHAR(64) UNIQUE NOT NULL,
+    hint VARCHAR(16) NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create index on user_id for listing a user's keys
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// ObservedUserStore wraps a UserStore and reports successful changes to users,
+// so caches of user data can be invalidated
+type ObservedUserStore struct {
+	UserStore
+	onChange func(userID int)
+}
+
+var _ UserStore = (*ObservedUserStore)(nil)
+
+// NewObservedUserStore wraps store, calling onChange with the ID of each updated
+// or deleted user, or with 0 after a bulk change that may affect any user
+func NewObservedUserStore(store UserStore, onChange func(userID int)) *ObservedUserStore {
+	return &ObservedUserStore{
+		UserStore: store,
+		onChange:  onChange,
+	}
+}
+
+// Update updates a user and reports the change
+func (s *ObservedUserStore) Update(ctx context.Context, user *models.User) error {
+	if err := s.UserStore.Update(ctx, user); err != nil {
+		return err
+	}
+	s.onChange(user.ID)
+	return nil
+}
+
+// Delete deprovisions a user and reports the change
+func (s *ObservedUserStore) Delete(ctx context.Context, id int) error {
+	if err := s.UserStore.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.onChange(id)
+	return nil
+}
+
+// SuspendExpired suspends expired users and reports a bulk change if any were suspended
+func (s *ObservedUserStore) SuspendExpired(ctx context.Context, now time.Time) (int, error) {
+	suspended, err := s.UserStore.SuspendExpired(ctx, now)
+	if err == nil && suspended > 0 {
+		s.onChange(0)
+	}
+	return suspended, err
+}
+
+// ObservedGroupStore wraps a GroupStore and reports the users whose group
+// memberships changed, so cached roles can be invalidated
+type ObservedGroupStore struct {
+	GroupStore
+	onChange func(userID int)
+}
+
+var _ GroupStore = (*ObservedGroupStore)(nil)
+
+// NewObservedGroupStore wraps store, calling onChange with the ID of each user
+// added to or removed from a group, or with 0 when a group is renamed, deleted
+// or has its members replaced
+func NewObservedGroupStore(store GroupStore, onChange func(userID int)) *ObservedGroupStore {
+	return &ObservedGroupStore{
+		GroupStore: store,
+		onChange:   onChange,
+	}
+}
+
+// CreateGroup creates a group and reports its initial members
+func (s *ObservedGroupStore) CreateGroup(ctx context.Context, displayName string, memberIDs []int) (*models.Group, error) {
+	group, err := s.GroupStore.CreateGroup(ctx, displayName, memberIDs)
+	if err != nil {
+		return nil, err
+	}
+	s.changed(memberIDs)
+	return group, nil
+}
+
+// RenameGroup renames a group and reports a change for all users
+func (s *ObservedGroupStore) RenameGroup(ctx context.Context, id int, displayName string) error {
+	if err := s.GroupStore.RenameGroup(ctx, id, displayName); err != nil {
+		return err
+	}
+	s.onChange(0)
+	return nil
+}
+
+// DeleteGroup deletes a group and reports a change for all users
+func (s *ObservedGroupStore) DeleteGroup(ctx context.Context, id int) error {
+	if err := s.GroupStore.DeleteGroup(ctx, id); err != nil {
+		return err
+	}
+	s.onChange(0)
+	return nil
+}
+
+// AddGroupMembers adds members and reports them
+func (s *ObservedGroupStore) AddGroupMembers(ctx context.Context, groupID int, userIDs []int) error {
+	if err := s.GroupStore.AddGroupMembers(ctx, groupID, userIDs); err != nil {
+		return err
+	}
+	s.changed(userIDs)
+	return nil
+}
+
+// RemoveGroupMembers removes members and reports them
+func (s *ObservedGroupStore) RemoveGroupMembers(ctx context.Context, groupID int, userIDs []int) error {
+	if err := s.GroupStore.RemoveGroupMembers(ctx, groupID, userIDs); err != nil {
+		return err
+	}
+	s.changed(userIDs)
+	return nil
+}
+
+// SetGroupMembers replaces members and reports a change for all users
+func (s *ObservedGroupStore) SetGroupMembers(ctx context.Context, groupID int, userIDs []int) error {
+	if err := s.GroupStore.SetGroupMembers(ctx, groupID, userIDs); err != nil {
+		return err
+	}
+	s.onChange(0)
+	return nil
+}
+
+// changed reports each of the given users
+func (s *ObservedGroupStore) changed(userIDs []int) {
+	for _, id := range userIDs {
+		s.onChange(id)
+	}
+}
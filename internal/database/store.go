@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// UserStore defines the user persistence operations used by the JIT service and handlers.
+// All methods honour context cancellation and deadlines.
+type UserStore interface {
+	// GetByEmail retrieves a user by email address, returning nil if not found
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+
+	// GetByID retrieves a user by ID, returning nil if not found
+	GetByID(ctx context.Context, id int) (*models.User, error)
+
+	// Create creates a new user with the given status
+	Create(ctx context.Context, email, firstName, lastName, status string) (*models.User, error)
+
+	// GetOrCreate atomically creates a user with the given status, or returns the
+	// existing user with the same (normalized) email. created reports which happened.
+	GetOrCreate(ctx context.Context, email, firstName, lastName, status string) (user *models.User, created bool, err error)
+
+	// Update updates an existing user
+	Update(ctx context.Context, user *models.User) error
+
+	// Delete soft deletes a user (sets status to deprovisioned)
+	Delete(ctx context.Context, id int) error
+
+	// List returns all users with pagination
+	List(ctx context.Context, limit, offset int) ([]*models.User, error)
+
+	// ListByStatus returns users with the given status with pagination, oldest first
+	ListByStatus(ctx context.Context, status string, limit, offset int) ([]*models.User, error)
+
+	// SuspendExpired suspends active users whose access expired at or before now and returns how many were suspended
+	SuspendExpired(ctx context.Context, now time.Time) (int, error)
+
+	// GetByIdentity retrieves the user linked to an external identity, returning nil if not linked
+	GetByIdentity(ctx context.Context, idpEntityID, nameIDFormat, nameID string) (*models.User, error)
+
+	// LinkIdentity links an external identity to a user; linking an already linked identity is a no-op
+	LinkIdentity(ctx context.Context, userID int, idpEntityID, nameIDFormat, nameID string) error
+}
+
+// GroupStore defines the group persistence operations used by SCIM provisioning.
+// All methods honour context cancellation and deadlines.
+type GroupStore interface {
+	// GetGroup retrieves a group with its members by ID, returning nil if not found
+	GetGroup(ctx context.Context, id int) (*models.Group, error)
+
+	// GetGroupByName retrieves a group with its members by display name, returning nil if not found
+	GetGroupByName(ctx context.Context, displayName string) (*models.Group, error)
+
+	// ListGroups returns groups with their members with pagination, ordered by ID
+	ListGroups(ctx context.Context, limit, offset int) ([]*models.Group, error)
+
+	// ListUserGroups returns the groups a user belongs to, without members
+	ListUserGroups(ctx context.Context, userID int) ([]*models.Group, error)
+
+	// CreateGroup creates a new group with the given members
+	CreateGroup(ctx context.Context, displayName string, memberIDs []int) (*models.Group, error)
+
+	// RenameGroup changes a group's display name
+	RenameGroup(ctx context.Context, id int, displayName string) error
+
+	// DeleteGroup deletes a group and its memberships
+	DeleteGroup(ctx context.Context, id int) error
+
+	// AddGroupMembers adds users to a group; existing members are ignored
+	AddGroupMembers(ctx context.Context, groupID int, userIDs []int) error
+
+	// RemoveGroupMembers removes users from a group
+	RemoveGroupMembers(ctx context.Context, groupID int, userIDs []int) error
+
+	// SetGroupMembers replaces a group's members
+	SetGroupMembers(ctx context.Context, groupID int, userIDs []int) error
+}
+
+// APIKeyStore defines the persistence operations for users' API keys.
+// Keys are looked up by the SHA-256 hash of the key; the key itself is never stored.
+type APIKeyStore interface {
+	// CreateAPIKey stores a new key, setting its ID and creation time
+	CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error
+
+	// ListAPIKeys returns a user's keys, newest first
+	ListAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error)
+
+	// GetAPIKeyByHash retrieves a key by its hash, returning nil if not found
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+
+	// DeleteAPIKey deletes one of a user's keys, reporting whether it existed
+	DeleteAPIKey(ctx context.Context, userID, id int) (bool, error)
+
+	// TouchAPIKey records when a key was last used
+	TouchAPIKey(ctx context.Context, id int, usedAt time.Time) error
+}
@@ -1,42 +1,65 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	"saml-poc/internal/models"
 )
 
-// UserRepository handles user database operations
+// UserRepository handles user database operations against PostgreSQL or SQLite
 type UserRepository struct {
 	db *DB
 }
 
+var _ UserStore = (*UserRepository)(nil)
+
 // NewUserRepository creates a new user repository
 func NewUserRepository(db *DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// GetByEmail retrieves a user by email address
-func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
-	user := &models.User{}
-	query := `
-		SELECT id, email, first_name, last_name, is_active, created_at, updated_at
-		FROM users 
-		WHERE email = $1
-	`
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// userColumns is the column list read by scanUser
+const userColumns = `id, email, first_name, last_name, status,
+		COALESCE(suspension_reason, ''), access_expires_at, created_at, updated_at`
 
-	err := r.db.conn.QueryRow(query, email).Scan(
+// scanUser scans a row selected with userColumns
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(
 		&user.ID,
 		&user.Email,
 		&user.FirstName,
 		&user.LastName,
-		&user.IsActive,
+		&user.Status,
+		&user.SuspensionReason,
+		&user.AccessExpiresAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
 
+// GetByEmail retrieves a user by email address
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE LOWER(email) = $1
+	`
+
+	user, err := scanUser(r.db.conn.QueryRowContext(ctx, query, models.NormalizeEmail(email)))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // User not found
@@ -47,42 +70,95 @@ func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 	return user, nil
 }
 
-// Create creates a new user in the database
-func (r *UserRepository) Create(email, firstName, lastName string, isActive bool) (*models.User, error) {
+// GetByID retrieves a user by ID
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
 	query := `
-		INSERT INTO users (email, first_name, last_name, is_active, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, NOW(), NOW()) 
-		RETURNING id, email, first_name, last_name, is_active, created_at, updated_at
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1
 	`
 
-	user := &models.User{}
-	err := r.db.conn.QueryRow(query, email, firstName, lastName, isActive).Scan(
-		&user.ID,
-		&user.Email,
-		&user.FirstName,
-		&user.LastName,
-		&user.IsActive,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.conn.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // User not found
+		}
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+
+	return user, nil
+}
+
+// Create creates a new user in the database
+func (r *UserRepository) Create(ctx context.Context, email, firstName, lastName, status string) (*models.User, error) {
+	query := `
+		INSERT INTO users (email, first_name, last_name, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING ` + userColumns
 
+	user, err := scanUser(r.db.conn.QueryRowContext(ctx, query, models.NormalizeEmail(email), firstName, lastName, status))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	log.Printf("Successfully created new user: %s (%s %s)", user.Email, user.FirstName, user.LastName)
+	log.Printf("Successfully created new user: %s (%s %s, %s)", user.Email, user.FirstName, user.LastName, user.Status)
 	return user, nil
 }
 
-// Update updates an existing user
-func (r *UserRepository) Update(user *models.User) error {
+// GetOrCreate inserts a user unless one with the same email exists, in a single
+// statement, so concurrent first logins for one email cannot both fail or both create.
+// On conflict nothing is written and the existing user is returned.
+func (r *UserRepository) GetOrCreate(ctx context.Context, email, firstName, lastName, status string) (*models.User, bool, error) {
 	query := `
-		UPDATE users 
-		SET first_name = $2, last_name = $3, is_active = $4, updated_at = NOW()
+		INSERT INTO users (email, first_name, last_name, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT DO NOTHING
+		RETURNING ` + userColumns
+
+	email = models.NormalizeEmail(email)
+	user, err := scanUser(r.db.conn.QueryRowContext(ctx, query, email, firstName, lastName, status))
+	if err == nil {
+		log.Printf("Successfully created new user: %s (%s %s, %s)", user.Email, user.FirstName, user.LastName, user.Status)
+		return user, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	// Conflict: the row was committed by a concurrent insert (or existed already)
+	user, err = r.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, false, err
+	}
+	if user == nil {
+		return nil, false, fmt.Errorf("failed to create user: conflicting row for %s not found", email)
+	}
+
+	return user, false, nil
+}
+
+// Update updates an existing user, including an email change (stored normalized).
+// The suspension reason is cleared unless the user is suspended.
+func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
+	query := `
+		UPDATE users
+		SET email = $2, first_name = $3, last_name = $4, status = $5,
+			suspension_reason = $6, access_expires_at = $7, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
 	`
 
-	_, err := r.db.conn.Exec(query, user.ID, user.FirstName, user.LastName, user.IsActive)
+	user.Email = models.NormalizeEmail(user.Email)
+	if !user.IsSuspended() {
+		user.SuspensionReason = ""
+	}
+
+	var expiresAt interface{}
+	if user.AccessExpiresAt != nil {
+		expiresAt = user.AccessExpiresAt.UTC()
+	}
+
+	_, err := r.db.conn.ExecContext(ctx, query, user.ID, user.Email, user.FirstName, user.LastName, user.Status,
+		nullIfEmpty(user.SuspensionReason), expiresAt)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -90,11 +166,11 @@ func (r *UserRepository) Update(user *models.User) error {
 	return nil
 }
 
-// Delete soft deletes a user (sets is_active to false)
-func (r *UserRepository) Delete(id int) error {
-	query := `UPDATE users SET is_active = false, updated_at = NOW() WHERE id = $1`
+// Delete soft deletes a user (sets status to deprovisioned)
+func (r *UserRepository) Delete(ctx context.Context, id int) error {
+	query := `UPDATE users SET status = $2, suspension_reason = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
 
-	_, err := r.db.conn.Exec(query, id)
+	_, err := r.db.conn.ExecContext(ctx, query, id, models.UserStatusDeprovisioned)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -103,15 +179,56 @@ func (r *UserRepository) Delete(id int) error {
 }
 
 // List returns all users with pagination
-func (r *UserRepository) List(limit, offset int) ([]*models.User, error) {
+func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
 	query := `
-		SELECT id, email, first_name, last_name, is_active, created_at, updated_at
-		FROM users 
+		SELECT ` + userColumns + `
+		FROM users
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
 	`
 
-	rows, err := r.db.conn.Query(query, limit, offset)
+	return r.queryUsers(ctx, query, limit, offset)
+}
+
+// ListByStatus returns users with the given status with pagination, oldest first
+func (r *UserRepository) ListByStatus(ctx context.Context, status string, limit, offset int) ([]*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE status = $1
+		ORDER BY created_at ASC
+		LIMIT $2 OFFSET $3
+	`
+
+	return r.queryUsers(ctx, query, status, limit, offset)
+}
+
+// SuspendExpired suspends active users whose access expired at or before now
+// and returns the number of users suspended
+func (r *UserRepository) SuspendExpired(ctx context.Context, now time.Time) (int, error) {
+	query := `
+		UPDATE users
+		SET status = $1, suspension_reason = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE status = $3 AND access_expires_at IS NOT NULL AND access_expires_at <= $4
+	`
+
+	result, err := r.db.conn.ExecContext(ctx, query,
+		models.UserStatusSuspended, models.SuspensionReasonExpired, models.UserStatusActive, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to suspend expired users: %w", err)
+	}
+
+	suspended, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count suspended users: %w", err)
+	}
+
+	return int(suspended), nil
+}
+
+// queryUsers runs a query selecting user rows and scans the results
+func (r *UserRepository) queryUsers(ctx context.Context, query string, args ...interface{}) ([]*models.User, error) {
+	rows, err := r.db.conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
@@ -119,21 +236,24 @@ func (r *UserRepository) List(limit, offset int) ([]*models.User, error) {
 
 	var users []*models.User
 	for rows.Next() {
-		user := &models.User{}
-		err := rows.Scan(
-			&user.ID,
-			&user.Email,
-			&user.FirstName,
-			&user.LastName,
-			&user.IsActive,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
 		users = append(users, user)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate users: %w", err)
+	}
+
 	return users, nil
 }
+
+// nullIfEmpty stores empty strings as NULL
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"saml-poc/internal/middleware"
+	"saml-poc/internal/tokens"
+)
+
+// TokenHandler mints API tokens for the signed-in user
+type TokenHandler struct {
+	apiTokens *tokens.APITokens
+}
+
+// NewTokenHandler creates a new API token handler
+func NewTokenHandler(apiTokens *tokens.APITokens) *TokenHandler {
+	return &TokenHandler{apiTokens: apiTokens}
+}
+
+// ServeHTTP returns a new API token. It must run after DatabaseValidation.
+// Minting changes no state and browsers keep other sites from reading the
+// response, so GET is accepted for tools that open the URL in a browser.
+func (h *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "No authorized user found", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := h.apiTokens.Mint(user, middleware.RolesFromContext(r.Context()), time.Now())
+	if err != nil {
+		log.Printf("Failed to mint API token for %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("API token issued to %s", user.Email)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(h.apiTokens.TTL().Seconds()),
+	})
+}
+
+// MeHandler describes the authenticated user, whether they used an API token or the SAML session
+type MeHandler struct{}
+
+// NewMeHandler creates a new current-user handler
+func NewMeHandler() *MeHandler {
+	return &MeHandler{}
+}
+
+// ServeHTTP returns the current user as JSON. It must run after DatabaseValidation or AcceptBearerToken.
+func (h *MeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "No authorized user found", http.StatusUnauthorized)
+		return
+	}
+
+	roles := middleware.RolesFromContext(r.Context())
+	if roles == nil {
+		roles = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":         user.ID,
+		"email":      user.Email,
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"roles":      roles,
+	})
+}
+
+// writeJSON writes a JSON response that must not be cached
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
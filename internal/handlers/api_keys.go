@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"saml-poc/internal/database"
+	"saml-poc/internal/middleware"
+	"saml-poc/internal/models"
+	"saml-poc/internal/tokens"
+)
+
+// APIKeysPath lists and creates the current user's API keys; APIKeysPath + "{id}" deletes one
+const APIKeysPath = "/api/keys/"
+
+// maxAPIKeysPerUser caps how many keys one user can hold
+const maxAPIKeysPerUser = 50
+
+// APIKeyHandler lets users manage their own API keys
+type APIKeyHandler struct {
+	keys      database.APIKeyStore
+	dbTimeout time.Duration
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(keys database.APIKeyStore, dbTimeout time.Duration) *APIKeyHandler {
+	return &APIKeyHandler{
+		keys:      keys,
+		dbTimeout: dbTimeout,
+	}
+}
+
+// createAPIKeyRequest is the body of a key creation request
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// ServeHTTP handles key management requests. It must run after DatabaseValidation
+// or AcceptBearerToken. Keys cannot be used to manage keys, so a leaked key
+// cannot create more.
+func (h *APIKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "No authorized user found", http.StatusUnauthorized)
+		return
+	}
+	if _, usedKey := middleware.APIKeyFromContext(r.Context()); usedKey {
+		http.Error(w, "API keys cannot manage API keys", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.dbTimeout)
+	defer cancel()
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(APIKeysPath, "/")), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		h.listKeys(ctx, w, user)
+	case id == "" && r.Method == http.MethodPost:
+		h.createKey(ctx, w, r, user)
+	case id != "" && r.Method == http.MethodDelete:
+		h.deleteKey(ctx, w, user, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listKeys returns the user's keys without the secret part
+func (h *APIKeyHandler) listKeys(ctx context.Context, w http.ResponseWriter, user *models.User) {
+	keys, err := h.keys.ListAPIKeys(ctx, user.ID)
+	if err != nil {
+		log.Printf("Failed to list API keys for %s: %v", user.Email, err)
+		http.Error(w, "Failed to load API keys", http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []*models.APIKey{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// createKey creates a key and returns it; this is the only time the key is shown
+func (h *APIKeyHandler) createKey(ctx context.Context, w http.ResponseWriter, r *http.Request, user *models.User) {
+	// Requiring JSON makes browsers preflight cross-origin requests, which protects the session cookie
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		http.Error(w, "name is required and must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required: "+strings.Join(models.APIKeyScopes, ", "), http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !models.IsValidAPIKeyScope(scope) {
+			http.Error(w, "Unknown scope "+strconv.Quote(scope)+"; valid scopes: "+strings.Join(models.APIKeyScopes, ", "), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.keys.ListAPIKeys(ctx, user.ID)
+	if err != nil {
+		log.Printf("Failed to list API keys for %s: %v", user.Email, err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		http.Error(w, "Too many API keys; delete unused keys first", http.StatusConflict)
+		return
+	}
+
+	secret, hash, hint, err := tokens.GenerateAPIKey()
+	if err != nil {
+		log.Printf("Failed to generate API key: %v", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	key := &models.APIKey{
+		UserID:    user.ID,
+		Name:      req.Name,
+		Hint:      hint,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := h.keys.CreateAPIKey(ctx, key, hash); err != nil {
+		log.Printf("Failed to create API key for %s: %v", user.Email, err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("API key %d (%s) created by %s", key.ID, key.Name, user.Email)
+	writeJSON(w, http.StatusCreated, struct {
+		*models.APIKey
+		Key string `json:"key"`
+	}{key, secret})
+}
+
+// deleteKey deletes one of the user's keys
+func (h *APIKeyHandler) deleteKey(ctx context.Context, w http.ResponseWriter, user *models.User, rawID string) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	deleted, err := h.keys.DeleteAPIKey(ctx, user.ID, id)
+	if err != nil {
+		log.Printf("Failed to delete API key %d for %s: %v", id, user.Email, err)
+		http.Error(w, "Failed to delete API key", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("API key %d deleted by %s", id, user.Email)
+	w.WriteHeader(http.StatusNoContent)
+}
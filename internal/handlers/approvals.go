@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"saml-poc/internal/database"
+	"saml-poc/internal/middleware"
+	"saml-poc/internal/models"
+	"saml-poc/internal/views"
+)
+
+// approvalQueueLimit caps the number of pending users shown at once
+const approvalQueueLimit = 100
+
+// ApprovalHandler handles the admin approval queue for pending JIT users
+type ApprovalHandler struct {
+	userRepo  database.UserStore
+	dbTimeout time.Duration
+	views     *views.Renderer
+}
+
+// NewApprovalHandler creates a new approval handler
+func NewApprovalHandler(userRepo database.UserStore, dbTimeout time.Duration, v *views.Renderer) *ApprovalHandler {
+	return &ApprovalHandler{
+		userRepo:  userRepo,
+		dbTimeout: dbTimeout,
+		views:     v,
+	}
+}
+
+// ServeHTTP handles the approval queue request. The route table normally
+// requires the admin role; it is checked here too so the queue stays
+// admin-only however the route is configured.
+func (h *ApprovalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !middleware.HasRole(r.Context(), middleware.RoleAdmin) {
+		h.views.RenderFailure(w, r, views.FailureRoleRequired, errors.New("the approval queue requires the admin role"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.dbTimeout)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		h.showQueue(ctx, w, r)
+	case http.MethodPost:
+		h.handleAction(ctx, w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAction approves or rejects a pending user
+func (h *ApprovalHandler) handleAction(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if !validCSRFToken(r) {
+		log.Printf("Rejected approval form post from %s: missing or invalid CSRF token", r.RemoteAddr)
+		http.Error(w, "Invalid or missing CSRF token; reload the page and try again", http.StatusForbidden)
+		return
+	}
+
+	action := r.FormValue("action")
+	if action != "approve" && action != "reject" {
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, id)
+	if err != nil {
+		log.Printf("Failed to load user %d for approval: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil || !user.IsPending() {
+		http.Error(w, "User is not awaiting approval", http.StatusConflict)
+		return
+	}
+
+	if action == "approve" {
+		user.Status = models.UserStatusActive
+	} else {
+		user.Suspend(models.SuspensionReasonRejected)
+	}
+	if err := h.userRepo.Update(ctx, user); err != nil {
+		log.Printf("Failed to %s user %s: %v", action, user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s: %s", action+"d", user.Email)
+	http.Redirect(w, r, r.URL.Path+"?"+url.Values{action + "d": {user.Email}}.Encode(), http.StatusSeeOther)
+}
+
+// approvalsPage is the data of the approval queue page
+type approvalsPage struct {
+	Users []*models.User
+	// Approved and Rejected name the user acted on by the previous request
+	Approved string
+	Rejected string
+	// CSRFToken must be posted back with the approve and reject forms
+	CSRFToken string
+}
+
+// showQueue displays the pending users with approve/reject actions
+func (h *ApprovalHandler) showQueue(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	token, err := csrfToken(w, r)
+	if err != nil {
+		h.views.RenderFailure(w, r, views.FailureInternal, fmt.Errorf("failed to issue CSRF token: %w", err))
+		return
+	}
+
+	users, err := h.userRepo.ListByStatus(ctx, models.UserStatusPending, approvalQueueLimit, 0)
+	if err != nil {
+		log.Printf("Failed to load approval queue: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.views.Render(w, http.StatusOK, views.PageApprovals, "Approval Queue", approvalsPage{
+		Users:    users,
+		Approved: r.URL.Query().Get("approved"),
+		Rejected: r.URL.Query().Get("rejected"),
+
+		CSRFToken: token,
+	})
+}
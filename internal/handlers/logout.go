@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/crewjam/saml/samlsp"
+
+	"saml-poc/internal/views"
+)
+
+// LogoutHandler signs users out of this application by deleting the SAML session cookie
+type LogoutHandler struct {
+	sessions samlsp.SessionProvider
+	views    *views.Renderer
+}
+
+// NewLogoutHandler creates a new logout handler
+func NewLogoutHandler(sessions samlsp.SessionProvider, v *views.Renderer) *LogoutHandler {
+	return &LogoutHandler{
+		sessions: sessions,
+		views:    v,
+	}
+}
+
+// logoutPage is the data of the logout page
+type logoutPage struct {
+	SignedOut bool
+	// CSRFToken must be posted back with the sign-out form
+	CSRFToken string
+}
+
+// ServeHTTP asks for confirmation on GET and signs out on POST, so a link
+// or image on another site cannot sign the user out
+func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		token, err := csrfToken(w, r)
+		if err != nil {
+			h.views.RenderFailure(w, r, views.FailureInternal, fmt.Errorf("failed to issue CSRF token: %w", err))
+			return
+		}
+		h.views.Render(w, http.StatusOK, views.PageLogout, "Sign Out", logoutPage{CSRFToken: token})
+	case http.MethodPost:
+		if !validCSRFToken(r) {
+			log.Printf("Rejected sign-out form post from %s: missing or invalid CSRF token", r.RemoteAddr)
+			http.Error(w, "Invalid or missing CSRF token; reload the page and try again", http.StatusForbidden)
+			return
+		}
+		if err := h.sessions.DeleteSession(w, r); err != nil {
+			h.views.RenderFailure(w, r, views.FailureSessionError, fmt.Errorf("failed to delete session: %w", err))
+			return
+		}
+		h.views.Render(w, http.StatusOK, views.PageLogout, "Signed Out", logoutPage{SignedOut: true})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"saml-poc/internal/database"
+)
+
+// ExpiryJob periodically suspends users whose access_expires_at has passed.
+// Expired users are already refused by User.IsAuthorized; the job makes the
+// suspension visible in the stored status.
+type ExpiryJob struct {
+	userRepo database.UserStore
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// NewExpiryJob creates a new expiry job running every interval, which must be positive,
+// with each run bounded by timeout
+func NewExpiryJob(userRepo database.UserStore, interval, timeout time.Duration) *ExpiryJob {
+	return &ExpiryJob{
+		userRepo: userRepo,
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+// Run suspends expired users immediately and then on every tick until ctx is cancelled
+func (j *ExpiryJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce performs a single expiry sweep
+func (j *ExpiryJob) runOnce(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+
+	suspended, err := j.userRepo.SuspendExpired(ctx, time.Now())
+	if err != nil {
+		log.Printf("Expiry job failed: %v", err)
+		return
+	}
+
+	if suspended > 0 {
+		log.Printf("Expiry job suspended %d user(s) with expired access", suspended)
+	}
+}
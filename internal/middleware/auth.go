@@ -1,23 +1,45 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/crewjam/saml/samlsp"
 
+	"saml-poc/internal/config"
+	"saml-poc/internal/database"
+	"saml-poc/internal/models"
 	"saml-poc/internal/saml"
+	"saml-poc/internal/tokens"
+	"saml-poc/internal/views"
 )
 
 // AuthMiddleware handles SAML authentication and user validation
 type AuthMiddleware struct {
 	jitService *saml.JITService
+	config     *config.Config
+	apiTokens  *tokens.APITokens
+	apiKeys    database.APIKeyStore
+	views      *views.Renderer
+	dbTimeout  time.Duration
 }
 
-// NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(jitService *saml.JITService) *AuthMiddleware {
+// NewAuthMiddleware creates a new authentication middleware.
+// The configured DB query timeout bounds the database validation performed for each request.
+// apiTokens and apiKeys may be nil to disable those bearer credentials.
+func NewAuthMiddleware(jitService *saml.JITService, cfg *config.Config, apiTokens *tokens.APITokens, apiKeys database.APIKeyStore, v *views.Renderer) *AuthMiddleware {
 	return &AuthMiddleware{
 		jitService: jitService,
+		config:     cfg,
+		apiTokens:  apiTokens,
+		apiKeys:    apiKeys,
+		views:      v,
+		dbTimeout:  cfg.Database.QueryTimeout,
 	}
 }
 
@@ -27,38 +49,108 @@ func (m *AuthMiddleware) DatabaseValidation(next http.Handler) http.Handler {
 		// Get SAML session from context (already authenticated by SAML)
 		session := samlsp.SessionFromContext(r.Context())
 		if session == nil {
-			http.Error(w, "No SAML session found", http.StatusUnauthorized)
+			m.views.RenderFailure(w, r, views.FailureNoSession, nil)
 			return
 		}
 
 		// Extract user attributes from SAML session
 		attrs := saml.ExtractUserAttributes(session, r)
-		if attrs.Email == "" {
-			log.Println("No email found in SAML session")
-			http.Error(w, "No email found in SAML session", http.StatusBadRequest)
-			return
-		}
 
 		log.Printf("Validating user from SAML session: %s (firstName: '%s', lastName: '%s')",
 			attrs.Email, attrs.FirstName, attrs.LastName)
 
-		// Validate user against database with JIT support
-		authorized, user, err := m.jitService.AuthorizeUserWithJIT(attrs)
-		if err != nil {
-			log.Printf("Database error during user validation: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+		// Validate user against database with JIT support, bounded by the DB timeout
+		ctx, cancel := context.WithTimeout(r.Context(), m.dbTimeout)
+		defer cancel()
+
+		decision := m.jitService.AuthorizeUserWithJIT(ctx, attrs)
+		switch decision.Outcome {
+		case saml.DecisionAllowed:
+			user := decision.User
+			log.Printf("User successfully validated: %s (%s %s)", user.Email, user.FirstName, user.LastName)
+
+			// User is authorized, proceed with the database record in the request context
+			ctx := WithUser(r.Context(), user, m.roles(user, decision.Roles), attrs)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		case saml.DecisionNeedsApproval:
+			log.Printf("User awaiting approval: %s", decision.User.Email)
+			m.renderPendingApproval(w, decision.User)
+		case saml.DecisionDenied:
+			m.views.RenderFailure(w, r, denialFailure(decision.Reason).WithMessage(decision.Message),
+				fmt.Errorf("user denied: %s: %s", attrs.Email, decision))
+		default:
+			m.renderDecisionError(ctx, w, r, attrs.Email, decision.Err)
 		}
+	})
+}
+
+// roles adds the admin role for configured administrators to the user's group roles
+func (m *AuthMiddleware) roles(user *models.User, groupRoles []string) []string {
+	roles := append([]string(nil), groupRoles...)
+	if m.config.IsAdmin(user.Email) {
+		roles = append(roles, RoleAdmin)
+	}
+	return roles
+}
+
+// denialFailures maps denial reason codes to the failure shown to the user
+var denialFailures = map[string]views.Failure{
+	saml.ReasonMissingAttributes: views.FailureMissingAttributes,
+	saml.ReasonUnknownUser:       views.FailureUnknownUser,
+	saml.ReasonPolicyDenied:      views.FailurePolicyDenied,
+	saml.ReasonSuspended:         views.FailureSuspended,
+	saml.ReasonExpired:           views.FailureExpired,
+	saml.ReasonDeprovisioned:     views.FailureDeprovisioned,
+}
+
+// denialFailure returns the failure for a denial reason, defaulting to a plain access denied
+func denialFailure(reason string) views.Failure {
+	if failure, ok := denialFailures[reason]; ok {
+		return failure
+	}
+	return views.FailureAccessDenied
+}
 
-		if !authorized {
-			log.Printf("User not authorized: %s", attrs.Email)
-			http.Error(w, "Access denied: User not authorized for this application", http.StatusForbidden)
+// renderDecisionError responds to a decision that failed with an error
+func (m *AuthMiddleware) renderDecisionError(ctx context.Context, w http.ResponseWriter, r *http.Request, email string, err error) {
+	switch {
+	case r.Context().Err() != nil:
+		// Client went away; nobody is left to read a response
+		log.Printf("Request cancelled during user validation for %s: %v", email, r.Context().Err())
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		w.Header().Set("Retry-After", "5")
+		m.views.RenderFailure(w, r, views.FailureUnavailable,
+			fmt.Errorf("database timeout after %s during user validation for %s: %w", m.dbTimeout, email, err))
+	default:
+		m.views.RenderFailure(w, r, views.FailureInternal,
+			fmt.Errorf("database error during user validation for %s: %w", email, err))
+	}
+}
+
+// RequireAdmin restricts access to users with the admin role.
+// It must run after DatabaseValidation, which puts the user and roles in the context.
+func (m *AuthMiddleware) RequireAdmin(next http.Handler) http.Handler {
+	return m.RequireRole([]string{RoleAdmin}, next)
+}
+
+// RequireRole restricts access to users holding any of roles.
+// It must run after DatabaseValidation, which puts the user and roles in the context.
+func (m *AuthMiddleware) RequireRole(roles []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			m.views.RenderFailure(w, r, views.FailureNoSession, nil)
 			return
 		}
 
-		log.Printf("User successfully validated: %s (%s %s)", user.Email, user.FirstName, user.LastName)
+		for _, role := range roles {
+			if HasRole(r.Context(), role) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
 
-		// User is authorized, proceed to the next handler
-		next.ServeHTTP(w, r)
+		m.views.RenderFailure(w, r, views.FailureRoleRequired.WithMessage("This page requires the "+strings.Join(roles, " or ")+" role."),
+			fmt.Errorf("access denied for %s: requires one of roles %v", user.Email, roles))
 	})
 }
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"saml-poc/internal/database"
+	"saml-poc/internal/models"
+	"saml-poc/internal/saml"
+	"saml-poc/internal/saml/samltest"
+	"saml-poc/internal/views"
+)
+
+// slowLookupStore delays email lookups so that every concurrent first login
+// finds no user before any of them creates one
+type slowLookupStore struct {
+	database.UserStore
+}
+
+// GetByEmail looks the user up, then waits for the other logins to do the same
+func (s slowLookupStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.UserStore.GetByEmail(ctx, email)
+	time.Sleep(20 * time.Millisecond)
+	return user, err
+}
+
+// TestDatabaseValidationConcurrentFirstLogin posts many SAML responses for one
+// new user to the ACS at once and opens a protected page with each resulting
+// session, as happens when a user signs in from several tabs. Every login must
+// reach the page as the same account, created once and linked to the IdP once.
+func TestDatabaseValidationConcurrentFirstLogin(t *testing.T) {
+	const logins = 20
+
+	cfg, idp := samltest.NewConfig(t)
+
+	db, err := database.New(database.DriverSQLite, filepath.Join(t.TempDir(), "acs.db"), database.Options{})
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	pageViews, err := views.New(&cfg.UI)
+	if err != nil {
+		t.Fatalf("failed to load page templates: %v", err)
+	}
+	samlProvider, err := saml.NewProvider(cfg, pageViews, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create SAML provider: %v", err)
+	}
+	idp.Trust(samlProvider)
+
+	jitService := saml.NewJITService(slowLookupStore{database.NewUserRepository(db)}, nil, &cfg.JIT, nil, nil)
+	authMiddleware := NewAuthMiddleware(jitService, cfg, nil, nil, pageViews)
+
+	mux := http.NewServeMux()
+	mux.Handle("/saml/", samlProvider)
+	mux.Handle("/home", samlProvider.RequireAccount(authMiddleware.DatabaseValidation(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := UserFromContext(r.Context())
+			fmt.Fprint(w, user.ID)
+		}))))
+
+	attributes := map[string]string{"email": "New.User@Example.com", "firstName": "New", "lastName": "User"}
+	forms := make([]url.Values, logins)
+	for i := range forms {
+		forms[i] = idp.Response(t, "new-user-1234", attributes)
+	}
+
+	userIDs := make([]int, logins)
+	errs := make([]error, logins)
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < logins; i++ {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			start.Wait()
+			userIDs[i], errs[i] = signIn(mux, forms[i])
+		}(i)
+	}
+	start.Done()
+	done.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("login %d failed: %v", i, err)
+		}
+		if userIDs[i] != userIDs[0] {
+			t.Fatalf("login %d signed in as user %d, want %d", i, userIDs[i], userIDs[0])
+		}
+	}
+
+	count := func(query string, args ...interface{}) int {
+		var n int
+		if err := db.GetConnection().QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("failed to count rows: %v", err)
+		}
+		return n
+	}
+	// The SQLite migrations seed sample users, so only count this one
+	if n := count(`SELECT COUNT(*) FROM users WHERE LOWER(email) = $1`, "new.user@example.com"); n != 1 {
+		t.Fatalf("got %d users rows, want 1", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM user_identities WHERE user_id = $1`, userIDs[0]); n != 1 {
+		t.Fatalf("got %d user_identities rows, want 1", n)
+	}
+}
+
+// signIn signs in with a SAML response, then opens /home with the session
+// and returns the ID of the user the page was served to
+func signIn(handler http.Handler, form url.Values) (int, error) {
+	cookies, err := samltest.SignIn(handler, form)
+	if err != nil {
+		return 0, err
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/home", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	home := httptest.NewRecorder()
+	handler.ServeHTTP(home, req)
+	if home.Code != http.StatusOK {
+		return 0, fmt.Errorf("/home returned %d: %s", home.Code, home.Header().Get(views.ErrorCodeHeader))
+	}
+	return strconv.Atoi(home.Body.String())
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"saml-poc/internal/models"
+	"saml-poc/internal/saml"
+	"saml-poc/internal/tokens"
+)
+
+// apiKeyTouchInterval limits how often an API key's last-used time is written
+const apiKeyTouchInterval = time.Minute
+
+// AcceptBearerToken authenticates requests carrying an API token from /api/token
+// or an API key, and hands every other request to fallback, normally the SAML
+// session chain (RequireAccount and DatabaseValidation). The credential's user
+// is checked against the database on each request, so suspended users are
+// refused even though their token or key is still valid.
+func (m *AuthMiddleware) AcceptBearerToken(next, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := BearerToken(r)
+		isAPIKey := ok && strings.HasPrefix(raw, models.APIKeyPrefix)
+		if !ok || (isAPIKey && m.apiKeys == nil) || (!isAPIKey && m.apiTokens == nil) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), m.dbTimeout)
+		defer cancel()
+
+		var userID int
+		var key *models.APIKey
+		if isAPIKey {
+			var err error
+			key, err = m.apiKeys.GetAPIKeyByHash(ctx, tokens.HashAPIKey(raw))
+			if err != nil {
+				m.bearerError(w, "API key lookup", err)
+				return
+			}
+			if key == nil || key.IsExpired(time.Now()) {
+				log.Println("Rejected unknown or expired API key")
+				unauthorized(w, "Invalid or expired API key")
+				return
+			}
+			userID = key.UserID
+		} else {
+			claims, err := m.apiTokens.Verify(raw)
+			if err != nil {
+				log.Printf("Rejected API token: %v", err)
+				unauthorized(w, "Invalid or expired token")
+				return
+			}
+			userID = claims.UserID
+		}
+
+		decision := m.jitService.AuthorizeUserByID(ctx, userID)
+		switch decision.Outcome {
+		case saml.DecisionAllowed:
+			user := decision.User
+			attrs := saml.UserAttributes{Email: user.Email, FirstName: user.FirstName, LastName: user.LastName}
+			reqCtx := WithUser(r.Context(), user, m.roles(user, decision.Roles), attrs)
+			if key != nil {
+				m.touchAPIKey(ctx, key)
+				reqCtx = withAPIKey(reqCtx, key)
+			}
+			next.ServeHTTP(w, r.WithContext(reqCtx))
+		case saml.DecisionDenied, saml.DecisionNeedsApproval:
+			log.Printf("Bearer credential refused for user %d: %s", userID, decision)
+			http.Error(w, "Account is not active", http.StatusForbidden)
+		default:
+			m.bearerError(w, "user validation", decision.Err)
+		}
+	})
+}
+
+// RequireScope restricts API key requests to keys granted scope. Requests
+// authenticated with the SAML session or an API token act with the user's
+// full access and are not restricted.
+func (m *AuthMiddleware) RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, ok := APIKeyFromContext(r.Context()); ok && !key.HasScope(scope) {
+			log.Printf("API key %d lacks scope %s", key.ID, scope)
+			http.Error(w, "API key is missing the "+scope+" scope", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// touchAPIKey records the key's use, at most once per apiKeyTouchInterval.
+// A failure is logged but does not fail the request.
+func (m *AuthMiddleware) touchAPIKey(ctx context.Context, key *models.APIKey) {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < apiKeyTouchInterval {
+		return
+	}
+	if err := m.apiKeys.TouchAPIKey(ctx, key.ID, now); err != nil {
+		log.Printf("Failed to record use of API key %d: %v", key.ID, err)
+		return
+	}
+	key.LastUsedAt = &now
+}
+
+// bearerError responds to a database failure while authenticating a bearer credential
+func (m *AuthMiddleware) bearerError(w http.ResponseWriter, step string, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("Database timeout during bearer %s: %v", step, err)
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("Database error during bearer %s: %v", step, err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// unauthorized responds 401 to an invalid bearer credential
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// BearerToken returns the token from an "Authorization: Bearer" header; the
+// scheme is case-insensitive (RFC 6750)
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
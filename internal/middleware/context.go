@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+
+	"saml-poc/internal/models"
+	"saml-poc/internal/saml"
+)
+
+// RoleAdmin is granted to users listed in ADMIN_EMAILS
+const RoleAdmin = "admin"
+
+// identityKey is the context key for the authorized identity
+type identityKey struct{}
+
+// identity is the authorized user stored in the request context
+type identity struct {
+	user   *models.User
+	roles  []string
+	attrs  saml.UserAttributes
+	apiKey *models.APIKey // set when the request authenticated with an API key
+}
+
+// WithUser returns a copy of ctx carrying the authorized user, their roles and
+// the SAML attributes they signed in with
+func WithUser(ctx context.Context, user *models.User, roles []string, attrs saml.UserAttributes) context.Context {
+	return context.WithValue(ctx, identityKey{}, &identity{user: user, roles: roles, attrs: attrs})
+}
+
+// UserFromContext returns the authorized database user, if the request passed DatabaseValidation
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	if !ok {
+		return nil, false
+	}
+	return id.user, true
+}
+
+// RolesFromContext returns the authorized user's roles
+func RolesFromContext(ctx context.Context) []string {
+	if id, ok := ctx.Value(identityKey{}).(*identity); ok {
+		return id.roles
+	}
+	return nil
+}
+
+// AttributesFromContext returns the SAML attributes of the authorized user
+func AttributesFromContext(ctx context.Context) (saml.UserAttributes, bool) {
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	if !ok {
+		return saml.UserAttributes{}, false
+	}
+	return id.attrs, true
+}
+
+// HasRole reports whether the authorized user has the given role
+func HasRole(ctx context.Context, role string) bool {
+	for _, r := range RolesFromContext(ctx) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// withAPIKey records that the authorized user authenticated with an API key
+func withAPIKey(ctx context.Context, key *models.APIKey) context.Context {
+	if id, ok := ctx.Value(identityKey{}).(*identity); ok {
+		withKey := *id
+		withKey.apiKey = key
+		return context.WithValue(ctx, identityKey{}, &withKey)
+	}
+	return ctx
+}
+
+// APIKeyFromContext returns the API key the request authenticated with, if any
+func APIKeyFromContext(ctx context.Context) (*models.APIKey, bool) {
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	if !ok || id.apiKey == nil {
+		return nil, false
+	}
+	return id.apiKey, true
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// AllowNetworks serves next to clients connecting from one of networks and
+// hands every other request to fallback, normally a chain requiring a role.
+// Only the address of the direct peer is checked: X-Forwarded-For can be set
+// by anyone, so behind a reverse proxy the proxy's own address decides.
+func AllowNetworks(networks []netip.Prefix, next, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inNetworks(remoteAddr(r), networks) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// remoteAddr returns the address of the direct peer, or the zero address if it cannot be parsed
+func remoteAddr(r *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
+
+// inNetworks reports whether addr is in any of networks
+func inNetworks(addr netip.Addr, networks []netip.Prefix) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
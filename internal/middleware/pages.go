@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"net/http"
+
+	"saml-poc/internal/models"
+	"saml-poc/internal/views"
+)
+
+// renderPendingApproval shows a friendly page to users whose account awaits admin approval
+func (m *AuthMiddleware) renderPendingApproval(w http.ResponseWriter, user *models.User) {
+	w.Header().Set(views.ErrorCodeHeader, views.CodePendingApproval)
+	m.views.Render(w, http.StatusForbidden, views.PagePending, "Awaiting Approval", user)
+}
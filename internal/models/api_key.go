@@ -0,0 +1,66 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so keys are recognisable in logs and secret scanners
+const APIKeyPrefix = "sk_"
+
+// API key scopes
+const (
+	ScopeProfileRead = "profile:read" // read the owner's profile at /api/me
+)
+
+// APIKeyScopes are the scopes that can be granted to an API key
+var APIKeyScopes = []string{ScopeProfileRead}
+
+// APIKey is a long-lived credential a user created for automation.
+// Only a hash of the key is stored; the key itself is shown once at creation.
+type APIKey struct {
+	ID     int      `json:"id" db:"id"`
+	UserID int      `json:"-" db:"user_id"`
+	Name   string   `json:"name" db:"name"`
+	Hint   string   `json:"hint" db:"hint"` // leading characters of the key, to tell keys apart
+	Scopes []string `json:"scopes" db:"scopes"`
+
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// IsExpired reports whether the key has passed its expiry time
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// HasScope reports whether the key grants scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidAPIKeyScope reports whether scope can be granted to an API key
+func IsValidAPIKeyScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinScopes encodes scopes for storage
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// SplitScopes decodes stored scopes
+func SplitScopes(value string) []string {
+	return strings.Fields(value)
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Group represents a group of users, provisioned via SCIM
+type Group struct {
+	ID          int       `json:"id" db:"id"`
+	DisplayName string    `json:"display_name" db:"display_name"`
+	MemberIDs   []int     `json:"member_ids"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
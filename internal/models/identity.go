@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an external SAML identity (IdP entity ID + NameID)
+type UserIdentity struct {
+	ID           int       `json:"id" db:"id"`
+	UserID       int       `json:"user_id" db:"user_id"`
+	IdPEntityID  string    `json:"idp_entity_id" db:"idp_entity_id"`
+	NameIDFormat string    `json:"name_id_format" db:"name_id_format"`
+	NameID       string    `json:"name_id" db:"name_id"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
@@ -1,6 +1,24 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// User statuses
+const (
+	UserStatusActive        = "active"        // may sign in
+	UserStatusPending       = "pending"       // created via JIT, awaiting admin approval
+	UserStatusSuspended     = "suspended"     // temporarily blocked, see SuspensionReason
+	UserStatusDeprovisioned = "deprovisioned" // removed from the application
+)
+
+// Suspension reasons set by the application
+const (
+	SuspensionReasonExpired     = "Access expired"
+	SuspensionReasonRejected    = "Access request rejected"
+	SuspensionReasonDeactivated = "Deactivated by identity provider"
+)
 
 // User represents a user in the system
 type User struct {
@@ -8,9 +26,14 @@ type User struct {
 	Email     string    `json:"email" db:"email"`
 	FirstName string    `json:"first_name" db:"first_name"`
 	LastName  string    `json:"last_name" db:"last_name"`
-	IsActive  bool      `json:"is_active" db:"is_active"`
+	Status    string    `json:"status" db:"status"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	// SuspensionReason explains why the user is suspended
+	SuspensionReason string `json:"suspension_reason,omitempty" db:"suspension_reason"`
+	// AccessExpiresAt optionally ends access at a fixed time, e.g. for contractors
+	AccessExpiresAt *time.Time `json:"access_expires_at,omitempty" db:"access_expires_at"`
 }
 
 // FullName returns the user's full name
@@ -18,7 +41,34 @@ func (u *User) FullName() string {
 	return u.FirstName + " " + u.LastName
 }
 
-// IsAuthorized checks if the user is authorized (active)
+// IsAuthorized checks if the user is authorized (active and not expired)
 func (u *User) IsAuthorized() bool {
-	return u.IsActive
+	return u.Status == UserStatusActive && !u.IsExpired(time.Now())
+}
+
+// IsExpired checks if the user's access has expired at the given time
+func (u *User) IsExpired(now time.Time) bool {
+	return u.AccessExpiresAt != nil && !now.Before(*u.AccessExpiresAt)
+}
+
+// IsSuspended checks if the user is suspended
+func (u *User) IsSuspended() bool {
+	return u.Status == UserStatusSuspended
+}
+
+// Suspend suspends the user with a reason
+func (u *User) Suspend(reason string) {
+	u.Status = UserStatusSuspended
+	u.SuspensionReason = reason
+}
+
+// IsPending checks if the user is awaiting admin approval
+func (u *User) IsPending() bool {
+	return u.Status == UserStatusPending
+}
+
+// NormalizeEmail returns the canonical (trimmed, lowercased) form of an email address
+// used for storage and lookups, so addresses differing only in case map to one user
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
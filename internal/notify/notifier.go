@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/models"
+)
+
+// Notifier sends notifications about users awaiting approval
+type Notifier interface {
+	// NotifyPendingApproval announces a newly provisioned user that needs admin approval
+	NotifyPendingApproval(ctx context.Context, user *models.User) error
+}
+
+// New creates the notifier selected by configuration.
+// approvalURL is the admin approval queue linked from notifications.
+func New(cfg *config.NotifyConfig, approvalURL string) (Notifier, error) {
+	switch cfg.Type {
+	case "", "log":
+		return &LogNotifier{}, nil
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("NOTIFY_WEBHOOK_URL is required for the webhook notifier")
+		}
+		return NewWebhookNotifier(cfg.WebhookURL, approvalURL), nil
+	case "smtp":
+		if cfg.SMTPHost == "" || cfg.SMTPFrom == "" || len(cfg.SMTPTo) == 0 {
+			return nil, fmt.Errorf("NOTIFY_SMTP_HOST, NOTIFY_SMTP_FROM and NOTIFY_SMTP_TO are required for the smtp notifier")
+		}
+		return NewSMTPNotifier(cfg, approvalURL), nil
+	default:
+		return nil, fmt.Errorf("unsupported NOTIFY_TYPE: %s", cfg.Type)
+	}
+}
+
+// LogNotifier writes notifications to the application log
+type LogNotifier struct{}
+
+// NotifyPendingApproval logs the pending user
+func (n *LogNotifier) NotifyPendingApproval(ctx context.Context, user *models.User) error {
+	log.Printf("User awaiting approval: %s (%s)", user.Email, user.FullName())
+	return nil
+}
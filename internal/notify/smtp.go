@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/models"
+)
+
+// headerReplacer strips line breaks from values placed in mail headers
+var headerReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// SMTPNotifier emails notifications to a fixed list of recipients
+type SMTPNotifier struct {
+	addr        string
+	auth        smtp.Auth
+	from        string
+	to          []string
+	approvalURL string
+}
+
+// NewSMTPNotifier creates a new SMTP notifier. Authentication is only used when a username is configured,
+// so local stubs such as MailHog work without credentials.
+func NewSMTPNotifier(cfg *config.NotifyConfig, approvalURL string) *SMTPNotifier {
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	return &SMTPNotifier{
+		addr:        net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		auth:        auth,
+		from:        cfg.SMTPFrom,
+		to:          cfg.SMTPTo,
+		approvalURL: approvalURL,
+	}
+}
+
+// NotifyPendingApproval emails the approvers about the pending user
+func (n *SMTPNotifier) NotifyPendingApproval(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Attribute values come from the IdP; keep them from injecting headers
+	subject := "User awaiting approval: " + headerReplacer.Replace(user.Email)
+	body := fmt.Sprintf("%s (%s) signed in for the first time and is awaiting approval.\r\n\r\nReview the approval queue: %s\r\n",
+		user.FullName(), user.Email, n.approvalURL)
+
+	message := strings.Join([]string{
+		"From: " + n.from,
+		"To: " + strings.Join(n.to, ", "),
+		"Subject: " + subject,
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(n.addr, n.auth, n.from, n.to, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
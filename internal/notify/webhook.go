@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// WebhookNotifier posts JSON notifications to a webhook URL
+type WebhookNotifier struct {
+	url         string
+	approvalURL string
+	client      *http.Client
+}
+
+// webhookPayload is the JSON body sent to the webhook
+type webhookPayload struct {
+	Event       string       `json:"event"`
+	User        *models.User `json:"user"`
+	ApprovalURL string       `json:"approval_url"`
+}
+
+// NewWebhookNotifier creates a new webhook notifier
+func NewWebhookNotifier(url, approvalURL string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:         url,
+		approvalURL: approvalURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NotifyPendingApproval posts a user.pending_approval event
+func (n *WebhookNotifier) NotifyPendingApproval(ctx context.Context, user *models.User) error {
+	body, err := json.Marshal(webhookPayload{
+		Event:       "user.pending_approval",
+		User:        user,
+		ApprovalURL: n.approvalURL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
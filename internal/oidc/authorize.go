@@ -0,0 +1,112 @@
+package oidc
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"saml-poc/internal/middleware"
+)
+
+// ServeAuthorize issues an authorization code to the client and redirects back to it.
+// It must run after DatabaseValidation, so the user has signed in with SAML
+// and is authorized before any code is issued.
+func (p *Provider) ServeAuthorize(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "No authorized user found", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	client, ok := p.clients[query.Get("client_id")]
+	if !ok {
+		http.Error(w, "Unknown OIDC client", http.StatusBadRequest)
+		return
+	}
+
+	// Errors are only sent back to registered redirect URIs
+	redirectURI := query.Get("redirect_uri")
+	if !contains(client.RedirectURIs, redirectURI) {
+		log.Printf("OIDC client %s used unregistered redirect URI: %q", client.ID, redirectURI)
+		http.Error(w, "Invalid redirect_uri for this client", http.StatusBadRequest)
+		return
+	}
+
+	state := query.Get("state")
+	fail := func(code, description string) {
+		redirectWithParams(w, r, redirectURI, url.Values{"error": {code}, "error_description": {description}, "state": {state}})
+	}
+
+	scopes := strings.Fields(query.Get("scope"))
+	switch {
+	case query.Get("response_type") != "code":
+		fail("unsupported_response_type", "Only the authorization code flow is supported")
+		return
+	case !contains(scopes, "openid"):
+		fail("invalid_scope", "The openid scope is required")
+		return
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		fail("invalid_request", "PKCE with code_challenge_method=S256 is required")
+		return
+	}
+
+	code, err := p.codes.issue(&authCode{
+		clientID:      client.ID,
+		redirectURI:   redirectURI,
+		userID:        user.ID,
+		roles:         middleware.RolesFromContext(r.Context()),
+		scope:         strings.Join(grantedScopes(scopes), " "),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	})
+	if err != nil {
+		log.Printf("Failed to issue OIDC authorization code: %v", err)
+		fail("server_error", "Could not issue an authorization code")
+		return
+	}
+
+	log.Printf("OIDC authorization code issued to %s for %s", client.ID, user.Email)
+	redirectWithParams(w, r, redirectURI, url.Values{"code": {code}, "state": {state}})
+}
+
+// grantedScopes keeps the requested scopes this provider supports
+func grantedScopes(requested []string) []string {
+	var granted []string
+	for _, scope := range requested {
+		if contains(supportedScopes, scope) && !contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted
+}
+
+// redirectWithParams redirects to uri with params added to its query, omitting empty values
+func redirectWithParams(w http.ResponseWriter, r *http.Request, uri string, params url.Values) {
+	target, err := url.Parse(uri)
+	if err != nil {
+		// Registered redirect URIs are checked at startup, so this is a configuration bug
+		log.Printf("Failed to parse OIDC redirect URI %q: %v", uri, err)
+		http.Error(w, "Invalid redirect_uri", http.StatusInternalServerError)
+		return
+	}
+	query := target.Query()
+	for key, values := range params {
+		if values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// contains reports whether values includes value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// authCode is an issued authorization code waiting to be exchanged for tokens
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	userID        int
+	roles         []string
+	scope         string
+	nonce         string
+	codeChallenge string
+	expires       time.Time
+}
+
+// codeStore keeps authorization codes in memory until they are redeemed or expire
+type codeStore struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	codes map[string]*authCode
+}
+
+// newCodeStore creates a code store whose codes are valid for ttl
+func newCodeStore(ttl time.Duration) *codeStore {
+	return &codeStore{ttl: ttl, codes: make(map[string]*authCode)}
+}
+
+// issue stores code data under a new random code and returns the code
+func (s *codeStore) issue(code *authCode) (string, error) {
+	value, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, c := range s.codes {
+		if now.After(c.expires) {
+			delete(s.codes, key)
+		}
+	}
+
+	code.expires = now.Add(s.ttl)
+	s.codes[value] = code
+	return value, nil
+}
+
+// redeem returns and removes a code; codes can be used only once
+func (s *codeStore) redeem(value string) (*authCode, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[value]
+	if !ok {
+		return nil, false
+	}
+	delete(s.codes, value)
+	if time.Now().After(code.expires) {
+		return nil, false
+	}
+	return code, true
+}
+
+// randomString returns n random bytes encoded as URL-safe base64
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,96 @@
+// Package oidc lets downstream applications sign users in with OpenID Connect
+// while the users themselves still authenticate with the SAML IdP.
+// It implements the authorization code flow with PKCE.
+package oidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/database"
+	"saml-poc/internal/tokens"
+)
+
+// Endpoint paths
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	AuthorizePath = "/oidc/authorize"
+	TokenPath     = "/oidc/token"
+	UserInfoPath  = "/oidc/userinfo"
+	JWKSPath      = "/oidc/jwks"
+)
+
+// supportedScopes are the scopes that add claims to tokens
+var supportedScopes = []string{"openid", "email", "profile", "groups"}
+
+// Provider is an OpenID Connect provider for the registered clients
+type Provider struct {
+	issuer    string
+	clients   map[string]config.OIDCClient
+	keys      *tokens.KeySet
+	users     database.UserStore
+	codes     *codeStore
+	tokenTTL  time.Duration
+	dbTimeout time.Duration
+}
+
+// NewProvider creates an OIDC provider. Tokens are signed with keys and their
+// claims are read from users.
+func NewProvider(cfg *config.OIDCConfig, keys *tokens.KeySet, users database.UserStore, dbTimeout time.Duration) *Provider {
+	clients := make(map[string]config.OIDCClient, len(cfg.Clients))
+	for _, client := range cfg.Clients {
+		clients[client.ID] = client
+	}
+
+	return &Provider{
+		issuer:    cfg.Issuer,
+		clients:   clients,
+		keys:      keys,
+		users:     users,
+		codes:     newCodeStore(cfg.CodeTTL),
+		tokenTTL:  cfg.TokenTTL,
+		dbTimeout: dbTimeout,
+	}
+}
+
+// Keys returns the key set that signs tokens, served at JWKSPath
+func (p *Provider) Keys() *tokens.KeySet {
+	return p.keys
+}
+
+// ServeDiscovery serves the OpenID Provider configuration document
+func (p *Provider) ServeDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + AuthorizePath,
+		"token_endpoint":                        p.issuer + TokenPath,
+		"userinfo_endpoint":                     p.issuer + UserInfoPath,
+		"jwks_uri":                              p.issuer + JWKSPath,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      supportedScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "nonce",
+			"email", "email_verified", "name", "given_name", "family_name", "groups",
+		},
+	})
+}
+
+// writeJSON writes a JSON response that must not be cached
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeTokenError writes an OAuth 2.0 error response
+func writeTokenError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
@@ -0,0 +1,203 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"saml-poc/internal/middleware"
+	"saml-poc/internal/models"
+)
+
+// idTokenClaims are the claims of an ID token
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce,omitempty"`
+	userClaims
+}
+
+// accessTokenClaims are the claims of an access token for the userinfo endpoint
+type accessTokenClaims struct {
+	jwt.RegisteredClaims
+	ClientID string   `json:"client_id"`
+	Scope    string   `json:"scope"`
+	Groups   []string `json:"groups,omitempty"`
+	TokenUse string   `json:"token_use"`
+}
+
+// userClaims are the standard claims about the user released for the granted scopes
+type userClaims struct {
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	GivenName     string   `json:"given_name,omitempty"`
+	FamilyName    string   `json:"family_name,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+}
+
+// accessTokenUse marks access tokens, so ID tokens cannot be used to call userinfo
+const accessTokenUse = "access"
+
+// ServeToken exchanges an authorization code for an ID token and access token
+func (p *Provider) ServeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeTokenError(w, http.StatusMethodNotAllowed, "invalid_request", "POST required")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "Only authorization_code is supported")
+		return
+	}
+
+	clientID, secret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	client, ok := p.clients[clientID]
+	if !ok || (client.Secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(client.Secret)) != 1) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oidc"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	code, ok := p.codes.redeem(r.PostForm.Get("code"))
+	if !ok || code.clientID != client.ID || code.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+		return
+	}
+	if !verifyPKCE(code.codeChallenge, r.PostForm.Get("code_verifier")) {
+		writeTokenError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	// Claims come from the current database record; access may have been revoked since the code was issued
+	ctx, cancel := context.WithTimeout(r.Context(), p.dbTimeout)
+	defer cancel()
+
+	user, err := p.users.GetByID(ctx, code.userID)
+	if err != nil {
+		log.Printf("Failed to load user %d for OIDC token: %v", code.userID, err)
+		writeTokenError(w, http.StatusInternalServerError, "server_error", "Could not load user")
+		return
+	}
+	if user == nil || !user.IsAuthorized() {
+		writeTokenError(w, http.StatusBadRequest, "invalid_grant", "User is no longer authorized")
+		return
+	}
+
+	now := time.Now()
+	registered := jwt.RegisteredClaims{
+		Issuer:    p.issuer,
+		Subject:   strconv.Itoa(user.ID),
+		Audience:  jwt.ClaimStrings{client.ID},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(p.tokenTTL)),
+	}
+
+	idToken, err := p.keys.Sign(idTokenClaims{
+		RegisteredClaims: registered,
+		Nonce:            code.nonce,
+		userClaims:       claimsFor(user, code.roles, code.scope),
+	})
+	if err != nil {
+		log.Printf("Failed to sign ID token: %v", err)
+		writeTokenError(w, http.StatusInternalServerError, "server_error", "Could not issue tokens")
+		return
+	}
+
+	accessToken, err := p.keys.Sign(accessTokenClaims{
+		RegisteredClaims: registered,
+		ClientID:         client.ID,
+		Scope:            code.scope,
+		Groups:           code.roles,
+		TokenUse:         accessTokenUse,
+	})
+	if err != nil {
+		log.Printf("Failed to sign access token: %v", err)
+		writeTokenError(w, http.StatusInternalServerError, "server_error", "Could not issue tokens")
+		return
+	}
+
+	log.Printf("OIDC tokens issued to %s for %s", client.ID, user.Email)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(p.tokenTTL.Seconds()),
+		"id_token":     idToken,
+		"scope":        code.scope,
+	})
+}
+
+// ServeUserInfo returns claims about the user an access token was issued for
+func (p *Provider) ServeUserInfo(w http.ResponseWriter, r *http.Request) {
+	raw, ok := middleware.BearerToken(r)
+	var claims accessTokenClaims
+	if !ok || p.keys.Verify(raw, &claims) != nil || claims.Issuer != p.issuer || claims.TokenUse != accessTokenUse {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_token", "Invalid or expired access token")
+		return
+	}
+
+	userID, _ := strconv.Atoi(claims.Subject)
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.dbTimeout)
+	defer cancel()
+
+	user, err := p.users.GetByID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user %d for OIDC userinfo: %v", userID, err)
+		writeTokenError(w, http.StatusInternalServerError, "server_error", "Could not load user")
+		return
+	}
+	if user == nil || !user.IsAuthorized() {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_token", "User is no longer authorized")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Subject string `json:"sub"`
+		userClaims
+	}{claims.Subject, claimsFor(user, claims.Groups, claims.Scope)})
+}
+
+// claimsFor returns the user claims released for the granted scopes
+func claimsFor(user *models.User, roles []string, scope string) userClaims {
+	scopes := strings.Fields(scope)
+	var claims userClaims
+	if contains(scopes, "email") {
+		claims.Email = user.Email
+		claims.EmailVerified = true // asserted by the SAML IdP
+	}
+	if contains(scopes, "profile") {
+		claims.Name = strings.TrimSpace(user.FullName())
+		claims.GivenName = user.FirstName
+		claims.FamilyName = user.LastName
+	}
+	if contains(scopes, "groups") {
+		claims.Groups = roles
+	}
+	return claims
+}
+
+// verifyPKCE checks an S256 code verifier against the code challenge
+func verifyPKCE(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/crewjam/saml/samlsp"
+
+	"saml-poc/internal/middleware"
+	"saml-poc/internal/views"
+)
+
+// HeaderReason carries the error code of a refused forward-auth subrequest,
+// such as AUTH-204 for a suspended account (see views.Failure)
+const HeaderReason = "X-Auth-Reason"
+
+// ForwardAuth answers the authorization subrequests made by nginx auth_request,
+// Traefik ForwardAuth and Envoy ext_authz before they serve a protected request
+type ForwardAuth struct {
+	sessions samlsp.SessionProvider
+	signer   *Signer
+	loginURL string
+	views    *views.Renderer
+}
+
+// NewForwardAuth creates a forward-auth handler. Users without a SAML session
+// are sent to loginURL with the original URL in the rd query parameter; v
+// renders the sign-in page shown to browsers that see the response directly.
+func NewForwardAuth(sessions samlsp.SessionProvider, signer *Signer, loginURL string, v *views.Renderer) *ForwardAuth {
+	return &ForwardAuth{sessions: sessions, signer: signer, loginURL: loginURL, views: v}
+}
+
+// RequireSession responds 401 with a sign-in redirect when there is no usable
+// SAML session. Unlike samlsp RequireAccount it never starts the SAML flow itself,
+// since the proxy rather than the browser makes the subrequest. Every response
+// of the wrapped chain is limited to 2xx, 401 and 403 (see verifyWriter).
+func (f *ForwardAuth) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = &verifyWriter{ResponseWriter: w}
+
+		session, err := f.sessions.GetSession(r)
+		if session != nil {
+			next.ServeHTTP(w, r.WithContext(samlsp.ContextWithSession(r.Context(), session)))
+			return
+		}
+		if err != nil && err != samlsp.ErrNoSession {
+			// A fresh sign-in replaces a session that cannot be read
+			log.Printf("Forward auth session error: %v", err)
+		}
+
+		f.renderSignIn(w, originalURL(r))
+	})
+}
+
+// verifyWriter keeps forward-auth responses to the statuses proxies understand:
+// nginx auth_request turns anything but 2xx, 401 and 403 into a 500 for the
+// user. Other statuses, such as 400 for missing attributes or 503 for a
+// database timeout, become 403. Refusals carry their error code in HeaderReason.
+type verifyWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader maps the status and sets HeaderReason for refusals
+func (w *verifyWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if status < 200 || status >= 300 {
+		reason := w.Header().Get(views.ErrorCodeHeader)
+		if reason == "" {
+			reason = strconv.Itoa(status)
+		}
+		w.Header().Set(HeaderReason, reason)
+		if status != http.StatusUnauthorized {
+			status = http.StatusForbidden
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends a 200 status first if none was written, like http.ResponseWriter
+func (w *verifyWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ServeHTTP approves the request and returns the user's identity in signed
+// X-Auth-* response headers for the proxy to pass upstream.
+// It must run after DatabaseValidation, which puts the user in the context.
+func (f *ForwardAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "No authorized user found", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	f.signer.SetIdentityHeaders(w.Header(), user, middleware.RolesFromContext(r.Context()), time.Now())
+	w.WriteHeader(http.StatusOK)
+}
+
+// renderSignIn responds 401 with the sign-in URL in the Location header, for
+// proxies that redirect themselves, and a page that redirects browsers shown
+// the response directly
+func (f *ForwardAuth) renderSignIn(w http.ResponseWriter, original string) {
+	signIn := f.loginURL
+	if original != "" {
+		signIn += "?rd=" + url.QueryEscape(original)
+	}
+
+	w.Header().Set(views.ErrorCodeHeader, views.FailureNoSession.Code)
+	w.Header().Set("Location", signIn)
+	w.Header().Set("Cache-Control", "no-store")
+	f.views.Render(w, http.StatusUnauthorized, views.PageSignIn, "Sign In Required", signInPage{SignInURL: signIn})
+}
+
+// signInPage is the data of the sign-in page
+type signInPage struct {
+	SignInURL string
+}
+
+// originalURL reconstructs the URL the user requested from the proxy's headers:
+// X-Original-URL (nginx) or X-Forwarded-Proto/Host/Uri (Traefik)
+func originalURL(r *http.Request) string {
+	if original := r.Header.Get("X-Original-URL"); original != "" {
+		return original
+	}
+
+	uri := r.Header.Get("X-Forwarded-Uri")
+	host := r.Header.Get("X-Forwarded-Host")
+	if uri == "" || host == "" {
+		return uri
+	}
+
+	scheme := r.Header.Get("X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "https"
+	}
+	return scheme + "://" + host + uri
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// Identity headers sent to upstream applications
+const (
+	HeaderUserID    = "X-Auth-User-Id"
+	HeaderEmail     = "X-Auth-Email"
+	HeaderName      = "X-Auth-Name"
+	HeaderRoles     = "X-Auth-Roles"
+	HeaderTimestamp = "X-Auth-Timestamp"
+	HeaderSignature = "X-Auth-Signature"
+)
+
+// identityHeaderPrefix covers every identity header; client copies are stripped
+const identityHeaderPrefix = "X-Auth-"
+
+// signatureVersion prefixes the signature so the scheme can evolve
+const signatureVersion = "v1="
+
+// Signer signs identity headers with HMAC-SHA256 so upstreams can verify
+// they were set by this service and not by the client
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner creates a header signer with a shared secret
+func NewSigner(secret string) *Signer {
+	return &Signer{secret: []byte(secret)}
+}
+
+// StripIdentityHeaders removes all X-Auth-* headers, so clients cannot impersonate users
+func StripIdentityHeaders(header http.Header) {
+	for name := range header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), identityHeaderPrefix) {
+			header.Del(name)
+		}
+	}
+}
+
+// SetIdentityHeaders replaces any identity headers with signed headers for user.
+// Roles are percent-encoded before being joined with commas: group names come
+// from SCIM displayName and may themselves contain commas, which would
+// otherwise split one group into several roles. Use ParseRoles to read them.
+func (s *Signer) SetIdentityHeaders(header http.Header, user *models.User, roles []string, now time.Time) {
+	StripIdentityHeaders(header)
+
+	header.Set(HeaderUserID, strconv.Itoa(user.ID))
+	header.Set(HeaderEmail, user.Email)
+	header.Set(HeaderName, strings.TrimSpace(user.FullName()))
+	header.Set(HeaderRoles, encodeRoles(roles))
+	header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	header.Set(HeaderSignature, signatureVersion+s.sign(header))
+}
+
+// Verify checks the signature and age of identity headers; upstream Go
+// services sharing the secret can use it to authenticate requests
+func (s *Signer) Verify(header http.Header, now time.Time, maxAge time.Duration) error {
+	signature := header.Get(HeaderSignature)
+	if !strings.HasPrefix(signature, signatureVersion) {
+		return errors.New("missing or unsupported identity signature")
+	}
+
+	expected := s.sign(header)
+	if !hmac.Equal([]byte(strings.TrimPrefix(signature, signatureVersion)), []byte(expected)) {
+		return errors.New("invalid identity signature")
+	}
+
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return errors.New("invalid identity timestamp")
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > maxAge || age < -maxAge {
+		return errors.New("identity headers expired")
+	}
+
+	return nil
+}
+
+// encodeRoles percent-encodes each role and joins them with commas
+func encodeRoles(roles []string) string {
+	encoded := make([]string, len(roles))
+	for i, role := range roles {
+		encoded[i] = url.PathEscape(role)
+	}
+	return strings.Join(encoded, ",")
+}
+
+// ParseRoles decodes the X-Auth-Roles header; upstream Go services should call
+// it after Verify rather than splitting the header themselves
+func ParseRoles(header http.Header) ([]string, error) {
+	value := header.Get(HeaderRoles)
+	if value == "" {
+		return nil, nil
+	}
+
+	var roles []string
+	for _, encoded := range strings.Split(value, ",") {
+		role, err := url.PathUnescape(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid role %q: %w", encoded, err)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// sign computes the hex HMAC over the signed identity headers
+func (s *Signer) sign(header http.Header) string {
+	mac := hmac.New(sha256.New, s.secret)
+	for _, name := range []string{HeaderTimestamp, HeaderUserID, HeaderEmail, HeaderName, HeaderRoles} {
+		mac.Write([]byte(header.Get(name)))
+		mac.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
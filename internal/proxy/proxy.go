@@ -0,0 +1,123 @@
+// Package proxy forwards authenticated requests to upstream applications that
+// do not speak SAML, passing the user's identity in signed X-Auth-* headers.
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/middleware"
+)
+
+// Handler forwards requests to the upstream whose path prefix matches
+type Handler struct {
+	routes        []route
+	signer        *Signer
+	sessionCookie string
+}
+
+// route is a path prefix served by one upstream
+type route struct {
+	prefix string
+	proxy  *httputil.ReverseProxy
+}
+
+// NewHandler creates a proxy handler for the configured routes. sessionCookie
+// is the SAML session cookie, which is never forwarded upstream.
+func NewHandler(routes []config.ProxyRoute, signer *Signer, sessionCookie string) (*Handler, error) {
+	h := &Handler{signer: signer, sessionCookie: sessionCookie}
+
+	for _, r := range routes {
+		target, err := url.Parse(r.Target)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return nil, fmt.Errorf("invalid upstream URL %q for %s", r.Target, r.Prefix)
+		}
+		h.routes = append(h.routes, route{prefix: r.Prefix, proxy: h.newReverseProxy(r.Prefix, target)})
+	}
+
+	// Longest prefix first, so /app/admin/ wins over /app/
+	sort.Slice(h.routes, func(i, k int) bool { return len(h.routes[i].prefix) > len(h.routes[k].prefix) })
+
+	return h, nil
+}
+
+// Prefixes returns the configured path prefixes
+func (h *Handler) Prefixes() []string {
+	prefixes := make([]string, len(h.routes))
+	for i, r := range h.routes {
+		prefixes[i] = r.prefix
+	}
+	return prefixes
+}
+
+// ServeHTTP forwards the request to the matching upstream.
+// It must run after DatabaseValidation, which puts the user in the context.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, ok := middleware.UserFromContext(r.Context()); !ok {
+		http.Error(w, "No authorized user found", http.StatusUnauthorized)
+		return
+	}
+
+	for _, route := range h.routes {
+		if strings.HasPrefix(r.URL.Path, route.prefix) {
+			route.proxy.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// newReverseProxy creates a reverse proxy that replaces prefix with the
+// target's path and injects signed identity headers
+func (h *Handler) newReverseProxy(prefix string, target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+
+			// /app/page with prefix /app/ and target http://upstream/base/ becomes /base/page
+			pr.Out.URL.Path = singleJoiningSlash(target.Path, strings.TrimPrefix(pr.In.URL.Path, prefix))
+			pr.Out.URL.RawPath = ""
+			pr.Out.Header.Set("X-Forwarded-Prefix", strings.TrimSuffix(prefix, "/"))
+
+			h.removeSessionCookie(pr.Out)
+
+			user, _ := middleware.UserFromContext(pr.In.Context())
+			h.signer.SetIdentityHeaders(pr.Out.Header, user, middleware.RolesFromContext(pr.In.Context()), time.Now())
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Proxy error for %s %s: %v", r.Method, r.URL.Path, err)
+			http.Error(w, "Upstream unavailable", http.StatusBadGateway)
+		},
+	}
+}
+
+// removeSessionCookie drops the SAML session cookie so upstreams cannot replay it
+func (h *Handler) removeSessionCookie(r *http.Request) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != h.sessionCookie {
+			r.AddCookie(cookie)
+		}
+	}
+}
+
+// singleJoiningSlash joins two URL paths with exactly one slash
+func singleJoiningSlash(a, b string) string {
+	switch {
+	case strings.HasSuffix(a, "/") && strings.HasPrefix(b, "/"):
+		return a + b[1:]
+	case !strings.HasSuffix(a, "/") && !strings.HasPrefix(b, "/"):
+		return a + "/" + b
+	}
+	return a + b
+}
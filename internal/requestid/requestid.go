@@ -0,0 +1,49 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Header carries the request ID to upstream applications and back to the client
+const Header = "X-Request-ID"
+
+// validID matches request IDs accepted from a front proxy; anything else is replaced
+var validID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type contextKey struct{}
+
+// Handler gives every request an ID, reusing a well-formed X-Request-ID from a
+// front proxy. The ID is the support reference shown on error pages and in the
+// matching log lines, and is passed on to proxied applications.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !validID.MatchString(id) {
+			id = newID()
+		}
+
+		r.Header.Set(Header, id)
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, id)))
+	})
+}
+
+// FromContext returns the request ID, or "" outside Handler
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// newID returns a short random ID that is easy to read out to support
+func newID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return strings.ToUpper(hex.EncodeToString(b))
+}
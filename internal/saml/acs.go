@@ -0,0 +1,76 @@
+package saml
+
+import (
+	"log"
+	"net/http"
+
+	"saml-poc/internal/views"
+)
+
+// ServeHTTP serves the SAML endpoints. The assertion consumer service is
+// handled here rather than by samlsp, so every post-login redirect, including
+// the RelayState of IdP-initiated logins, is checked against the allowlist.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == p.SP.ServiceProvider.AcsURL.Path {
+		p.serveACS(w, r)
+		return
+	}
+	p.SP.ServeHTTP(w, r)
+}
+
+// serveACS validates a SAML response, creates the session and returns the
+// user to the page they originally requested
+func (p *Provider) serveACS(w http.ResponseWriter, r *http.Request) {
+	m := p.SP
+	if err := r.ParseForm(); err != nil {
+		p.views.RenderFailure(w, r, views.FailureBadSignInRequest, err)
+		return
+	}
+
+	possibleRequestIDs := []string{}
+	if m.ServiceProvider.AllowIDPInitiated {
+		possibleRequestIDs = append(possibleRequestIDs, "")
+	}
+	for _, tracked := range m.RequestTracker.GetTrackedRequests(r) {
+		possibleRequestIDs = append(possibleRequestIDs, tracked.SAMLRequestID)
+	}
+
+	assertion, err := m.ServiceProvider.ParseResponse(r, possibleRequestIDs)
+	p.traceResponse(r, assertion, err)
+	if err != nil {
+		m.OnError(w, r, err)
+		return
+	}
+	if err := m.AssertionHandler.HandleAssertion(assertion); err != nil {
+		m.OnError(w, r, err)
+		return
+	}
+
+	// RelayState refers to the tracked SP-initiated request, or for an
+	// IdP-initiated login may itself be the page to open
+	var redirect string
+	if relayState := r.Form.Get("RelayState"); relayState != "" {
+		tracked, err := m.RequestTracker.GetTrackedRequest(r, relayState)
+		switch {
+		case err == nil:
+			if err := m.RequestTracker.StopTrackingRequest(w, r, relayState); err != nil {
+				m.OnError(w, r, err)
+				return
+			}
+			redirect = tracked.URI
+		case err == http.ErrNoCookie && m.ServiceProvider.AllowIDPInitiated:
+			log.Printf("IdP-initiated login with RelayState %q", relayState)
+			redirect = relayState
+		default:
+			m.OnError(w, r, err)
+			return
+		}
+	}
+
+	if err := m.Session.CreateSession(w, r, assertion); err != nil {
+		m.OnError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, p.redirectTarget(r, redirect).String(), http.StatusFound)
+}
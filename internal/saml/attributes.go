@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/crewjam/saml/samlsp"
+
+	"saml-poc/internal/models"
 )
 
 // UserAttributes represents extracted user attributes from SAML
@@ -11,16 +13,48 @@ type UserAttributes struct {
 	Email     string
 	FirstName string
 	LastName  string
+
+	// External identity from the assertion subject
+	NameID       string
+	NameIDFormat string
+	IdPEntityID  string
+
+	// Groups lists group memberships asserted by the IdP
+	Groups []string
+	// Raw holds every attribute from the assertion, for policy evaluation
+	Raw samlsp.Attributes
+}
+
+// HasPersistentNameID reports whether the assertion carried a stable NameID that can be linked to an account
+func (a UserAttributes) HasPersistentNameID() bool {
+	return a.NameID != "" && a.NameIDFormat == NameIDFormatPersistent && a.IdPEntityID != ""
 }
 
 // ExtractUserAttributes extracts user attributes from SAML session
 func ExtractUserAttributes(session samlsp.Session, r *http.Request) UserAttributes {
 	attrs := UserAttributes{}
 
+	// NameID is stored as the session subject
+	if claims, ok := session.(samlsp.JWTSessionClaims); ok {
+		attrs.NameID = claims.Subject
+	}
+
 	// Try to get attributes from session
 	if sessionWithAttrs, ok := session.(samlsp.SessionWithAttributes); ok {
 		samlAttrs := sessionWithAttrs.GetAttributes()
 
+		attrs.NameIDFormat = samlAttrs.Get(SessionAttrNameIDFormat)
+		attrs.IdPEntityID = samlAttrs.Get(SessionAttrIdPEntityID)
+		attrs.Raw = samlAttrs
+
+		// Extract group memberships from various possible attribute names
+		attrs.Groups = extractAttributeValues(samlAttrs, []string{
+			"groups",
+			"memberOf",
+			"Group",
+			"http://schemas.microsoft.com/ws/2008/06/identity/claims/groups",
+		})
+
 		// Extract email from various possible attribute names
 		attrs.Email = extractAttribute(samlAttrs, []string{
 			"email",
@@ -76,6 +110,9 @@ func ExtractUserAttributes(session samlsp.Session, r *http.Request) UserAttribut
 		})
 	}
 
+	// IdPs disagree on email casing; match users case-insensitively
+	attrs.Email = models.NormalizeEmail(attrs.Email)
+
 	return attrs
 }
 
@@ -89,6 +126,16 @@ func extractAttribute(attrs samlsp.Attributes, names []string) string {
 	return ""
 }
 
+// extractAttributeValues returns all values of the first attribute name present in SAML attributes
+func extractAttributeValues(attrs samlsp.Attributes, names []string) []string {
+	for _, name := range names {
+		if values := attrs[name]; len(values) > 0 {
+			return values
+		}
+	}
+	return nil
+}
+
 // extractAttributeFromContext extracts an attribute value from request context by trying multiple attribute names
 func extractAttributeFromContext(r *http.Request, names []string) string {
 	for _, name := range names {
@@ -0,0 +1,204 @@
+package saml
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DecisionCache is an in-process TTL/LRU cache of authorization decisions for
+// known users, so protected requests do not query the database every time.
+// Entries are invalidated when the user store reports a change to the user.
+type DecisionCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List              // front is most recently used
+	byUser     map[int]map[string]bool // user ID -> cache keys
+	generation uint64                  // bumped on every invalidation
+
+	hits          uint64
+	misses        uint64
+	evictions     uint64
+	invalidations uint64
+}
+
+// cacheEntry is a cached decision
+type cacheEntry struct {
+	key      string
+	decision Decision
+	expires  time.Time
+}
+
+// CacheStats reports cache usage
+type CacheStats struct {
+	Entries       int
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+}
+
+// HitRate returns the fraction of lookups served from the cache
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// NewDecisionCache creates a decision cache. It returns nil (caching disabled)
+// when ttl or maxEntries is not positive; all methods accept a nil cache.
+func NewDecisionCache(ttl time.Duration, maxEntries int) *DecisionCache {
+	if ttl <= 0 || maxEntries <= 0 {
+		return nil
+	}
+	return &DecisionCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		byUser:     make(map[int]map[string]bool),
+	}
+}
+
+// Get returns a cached decision and the generation to pass to Put after a miss.
+// Allowed decisions for users whose access expired since caching are treated as misses.
+func (c *DecisionCache) Get(key string) (Decision, uint64, bool) {
+	if c == nil {
+		return Decision{}, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok {
+		entry := elem.Value.(*cacheEntry)
+		now := time.Now()
+		if now.Before(entry.expires) && !(entry.decision.Allowed() && entry.decision.User.IsExpired(now)) {
+			c.lru.MoveToFront(elem)
+			c.hits++
+			return copyDecision(entry.decision), c.generation, true
+		}
+		c.remove(elem)
+	}
+
+	c.misses++
+	return Decision{}, c.generation, false
+}
+
+// Put caches a decision about a known user. It is ignored if the cache was
+// invalidated since generation was returned by Get, so a decision computed
+// from data read before a concurrent update is never stored.
+func (c *DecisionCache) Put(key string, decision Decision, generation uint64) {
+	if c == nil || decision.User == nil || decision.Outcome == DecisionError {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	decision = copyDecision(decision)
+	userID := decision.User.ID
+	entry := &cacheEntry{key: key, decision: decision, expires: time.Now().Add(c.ttl)}
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.byUser[userID] == nil {
+		c.byUser[userID] = make(map[string]bool)
+	}
+	c.byUser[userID][key] = true
+
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// copyDecision copies the user and roles of a decision so that callers
+// mutating what they stored or got back cannot change the cached entry
+func copyDecision(decision Decision) Decision {
+	user := *decision.User
+	if user.AccessExpiresAt != nil {
+		expires := *user.AccessExpiresAt
+		user.AccessExpiresAt = &expires
+	}
+	decision.User = &user
+	decision.Roles = append([]string(nil), decision.Roles...)
+	return decision
+}
+
+// InvalidateUser drops cached decisions for a user; a non-positive ID drops
+// everything, for bulk changes such as suspending all expired users
+func (c *DecisionCache) InvalidateUser(userID int) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.invalidations++
+
+	if userID <= 0 {
+		c.entries = make(map[string]*list.Element)
+		c.lru.Init()
+		c.byUser = make(map[int]map[string]bool)
+		return
+	}
+
+	for key := range c.byUser[userID] {
+		if elem, ok := c.entries[key]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+// Stats returns a snapshot of cache usage
+func (c *DecisionCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Entries:       c.lru.Len(),
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Evictions:     c.evictions,
+		Invalidations: c.invalidations,
+	}
+}
+
+// remove deletes an entry; the caller must hold the lock
+func (c *DecisionCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+
+	userID := entry.decision.User.ID
+	delete(c.byUser[userID], entry.key)
+	if len(c.byUser[userID]) == 0 {
+		delete(c.byUser, userID)
+	}
+}
+
+// decisionCacheKey identifies the SAML identity a decision was made for.
+// The email is always part of the key, so an email change reported by the
+// IdP misses the cache and is synced to the database.
+func decisionCacheKey(attrs UserAttributes) string {
+	if attrs.HasPersistentNameID() {
+		return "nameid\x00" + attrs.IdPEntityID + "\x00" + attrs.NameIDFormat + "\x00" + attrs.NameID + "\x00" + attrs.Email
+	}
+	return "email\x00" + attrs.Email
+}
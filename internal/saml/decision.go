@@ -0,0 +1,88 @@
+package saml
+
+import (
+	"fmt"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// Authorization decision outcomes
+const (
+	DecisionAllowed       = "allowed"        // user may proceed
+	DecisionDenied        = "denied"         // user is refused, see Reason
+	DecisionNeedsApproval = "needs_approval" // user exists but awaits admin approval
+	DecisionError         = "error"          // the decision could not be made, see Err
+)
+
+// Denial reason codes
+const (
+	ReasonUnknownUser       = "unknown_user"       // no account and JIT is disabled
+	ReasonMissingAttributes = "missing_attributes" // the IdP did not send attributes needed to identify or create the user
+	ReasonPolicyDenied      = "policy_denied"      // the JIT provisioning policy refused the user
+	ReasonSuspended         = "suspended"          // the account is suspended
+	ReasonExpired           = "expired"            // the account's access has expired
+	ReasonDeprovisioned     = "deprovisioned"      // the account was removed
+)
+
+// Decision is the result of authorizing a SAML-authenticated user
+type Decision struct {
+	Outcome string
+	Reason  string       // reason code for denied decisions
+	Message string       // user-facing explanation for denied decisions
+	User    *models.User // the matched or created user, if any
+	Roles   []string     // group names of an allowed user
+	Err     error        // cause of an error decision
+}
+
+// Allowed reports whether the user may proceed
+func (d Decision) Allowed() bool {
+	return d.Outcome == DecisionAllowed
+}
+
+// String describes the decision for logs
+func (d Decision) String() string {
+	switch d.Outcome {
+	case DecisionDenied:
+		return fmt.Sprintf("denied (%s): %s", d.Reason, d.Message)
+	case DecisionError:
+		return fmt.Sprintf("error: %v", d.Err)
+	}
+	return d.Outcome
+}
+
+// allow returns an allowed decision for user
+func allow(user *models.User) Decision {
+	return Decision{Outcome: DecisionAllowed, User: user}
+}
+
+// deny returns a denied decision with a reason code and user-facing message
+func deny(user *models.User, reason, message string) Decision {
+	return Decision{Outcome: DecisionDenied, Reason: reason, Message: message, User: user}
+}
+
+// failure returns an error decision
+func failure(err error) Decision {
+	return Decision{Outcome: DecisionError, Err: err}
+}
+
+// decideForUser maps an existing user's status to a decision
+func decideForUser(user *models.User) Decision {
+	switch {
+	case user.IsAuthorized():
+		return allow(user)
+	case user.IsPending():
+		return Decision{Outcome: DecisionNeedsApproval, User: user}
+	case user.Status == models.UserStatusDeprovisioned:
+		return deny(user, ReasonDeprovisioned, "Your account has been removed from this application.")
+	case user.IsSuspended():
+		message := "Your account is suspended."
+		if user.SuspensionReason != "" {
+			message = fmt.Sprintf("Your account is suspended (%s).", user.SuspensionReason)
+		}
+		return deny(user, ReasonSuspended, message)
+	case user.IsExpired(time.Now()):
+		return deny(user, ReasonExpired, "Your access has expired.")
+	}
+	return deny(user, ReasonSuspended, "Your account is not active.")
+}
@@ -0,0 +1,145 @@
+package saml
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+)
+
+// Causes of an invalid SAML response
+const (
+	CauseSignature       = "signature"        // signature or certificate does not verify
+	CauseClockSkew       = "clock_skew"       // response or assertion outside its validity window
+	CauseAudience        = "audience"         // assertion issued for another SP entity ID
+	CauseDestination     = "destination"      // response sent for another ACS URL
+	CauseIssuer          = "issuer"           // response from another IdP than the metadata
+	CauseRequestMismatch = "request_mismatch" // InResponseTo matches no sign-in started by this browser
+	CauseIdPStatus       = "idp_status"       // the IdP answered with a failure status
+	CauseDecryption      = "decryption"       // encrypted assertion could not be decrypted
+	CauseMalformed       = "malformed"        // not a parseable SAML response
+	CauseUnknown         = "unknown"
+)
+
+// causeHints explain each cause and what to check
+var causeHints = map[string]string{
+	CauseSignature:       "The IdP signing certificate does not match the IdP metadata, or the response was altered. Refresh the metadata in SAML_IDP_METADATA_PATH.",
+	CauseClockSkew:       "The response is outside its validity window. Check that the clocks of this server and the IdP are synchronised.",
+	CauseAudience:        "The assertion was issued for another service provider. The SP entity ID configured at the IdP must equal SAML_ENTITY_ID.",
+	CauseDestination:     "The response was addressed to another ACS URL. The ACS URL configured at the IdP must equal SAML_ACS_URL.",
+	CauseIssuer:          "The response comes from another IdP than the one described in SAML_IDP_METADATA_PATH.",
+	CauseRequestMismatch: "The response answers a sign-in this browser did not start, or one already completed. IdP-initiated logins need SAML_ALLOW_IDP_INITIATED.",
+	CauseIdPStatus:       "The IdP refused to sign the user in; its status code says why.",
+	CauseDecryption:      "The encrypted assertion could not be decrypted with the SP key. The IdP may hold an old SP certificate.",
+	CauseMalformed:       "The request did not contain a parseable SAML response.",
+	CauseUnknown:         "The response failed validation for a reason not recognised; see the detail.",
+}
+
+// causePatterns classify samlsp validation errors by their message. Order
+// matters: a signature error can mention an expired certificate.
+var causePatterns = []struct {
+	cause    string
+	fragment string
+}{
+	{CauseSignature, "signature"},
+	{CauseSignature, "certificate"},
+	{CauseDecryption, "decrypt"},
+	{CauseRequestMismatch, "inresponseto"},
+	{CauseRequestMismatch, "possible request ids"},
+	{CauseAudience, "audience"},
+	{CauseDestination, "destination"},
+	{CauseDestination, "recipient"},
+	{CauseIssuer, "issuer"},
+	{CauseClockSkew, "expired"},
+	{CauseClockSkew, "not yet valid"},
+	{CauseMalformed, "xml"},
+	{CauseMalformed, "base64"},
+	{CauseMalformed, "unmarshal"},
+	{CauseMalformed, "assertion, none found"},
+}
+
+// ClassifyResponseError returns the cause of a SAML response validation error
+func ClassifyResponseError(err error) string {
+	var status saml.ErrBadStatus
+	if errors.As(err, &status) {
+		return CauseIdPStatus
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, pattern := range causePatterns {
+		if strings.Contains(message, pattern.fragment) {
+			return pattern.cause
+		}
+	}
+	return CauseUnknown
+}
+
+// Diagnostic records why a SAML response was rejected
+type Diagnostic struct {
+	Time time.Time
+	// RequestID is the support reference shown to the user
+	RequestID string
+	Cause     string
+	Hint      string
+	// Detail is the validation error, which samlsp keeps from the user
+	Detail string
+	// ValidatedAt is the time the response was validated against
+	ValidatedAt time.Time
+	// ResponseXML is the response with personal data and secrets redacted; only kept in dev mode
+	ResponseXML string
+}
+
+// DiagnosticsStore keeps the most recent ACS failures in memory
+type DiagnosticsStore struct {
+	entries *ring[Diagnostic]
+}
+
+// NewDiagnosticsStore creates a store keeping up to max failures.
+// It returns nil, which records nothing, when max is not positive.
+func NewDiagnosticsStore(max int) *DiagnosticsStore {
+	if max <= 0 {
+		return nil
+	}
+	return &DiagnosticsStore{entries: newRing[Diagnostic](max)}
+}
+
+// Record adds a failure, dropping the oldest when the store is full
+func (s *DiagnosticsStore) Record(d Diagnostic) {
+	if s == nil {
+		return
+	}
+	s.entries.add(d)
+}
+
+// Recent returns the recorded failures, newest first
+func (s *DiagnosticsStore) Recent() []Diagnostic {
+	if s == nil {
+		return nil
+	}
+	return s.entries.recent()
+}
+
+// maxStoredXML caps the size of a stored SAML message
+const maxStoredXML = 64 << 10
+
+// redactedElements match elements whose content identifies the user or is
+// secret: attribute values, the subject, encrypted data and signatures
+var redactedElements = regexp.MustCompile(`(<(?:[A-Za-z0-9_.-]+:)?(?:AttributeValue|NameID|CipherValue|SignatureValue|X509Certificate)(?:\s[^>]*)?>)[^<]*`)
+
+// redactResponse removes personal data and secrets from a SAML response while
+// keeping the structure, issuers, audiences, destinations and timestamps that
+// explain a validation failure
+func redactResponse(xml string) string {
+	xml = truncateXML(xml)
+	return redactedElements.ReplaceAllString(xml, "${1}[redacted]")
+}
+
+// truncateXML caps a SAML message at maxStoredXML
+func truncateXML(xml string) string {
+	if len(xml) > maxStoredXML {
+		return xml[:maxStoredXML] + "\n<!-- truncated -->"
+	}
+	return xml
+}
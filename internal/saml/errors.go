@@ -0,0 +1,52 @@
+package saml
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/crewjam/saml"
+
+	"saml-poc/internal/requestid"
+	"saml-poc/internal/views"
+)
+
+// onError replaces samlsp's plain "Forbidden" response with an error page
+// explaining what failed. The details samlsp keeps out of the error message,
+// such as why a response was invalid, are logged with the support reference
+// and recorded in the diagnostics store.
+func (p *Provider) onError(w http.ResponseWriter, r *http.Request, err error) {
+	failure := views.FailureSessionError
+
+	var invalid *saml.InvalidResponseError
+	switch {
+	case errors.As(err, &invalid):
+		failure = views.FailureInvalidResponse
+		cause := ClassifyResponseError(invalid.PrivateErr)
+		p.recordInvalidResponse(r, cause, invalid)
+		err = fmt.Errorf("invalid SAML response (%s) at %s: %w", cause, invalid.Now.Format(time.RFC3339), invalid.PrivateErr)
+	case errors.Is(err, http.ErrNoCookie):
+		// The request tracking cookie is gone, so the response matches no sign-in from this browser
+		failure = views.FailureSignInExpired
+	}
+
+	p.views.RenderFailure(w, r, failure, err)
+}
+
+// recordInvalidResponse stores a diagnostic for a rejected response. The
+// response XML is only kept in dev mode, and then with personal data redacted.
+func (p *Provider) recordInvalidResponse(r *http.Request, cause string, invalid *saml.InvalidResponseError) {
+	diagnostic := Diagnostic{
+		Time:        time.Now(),
+		RequestID:   requestid.FromContext(r.Context()),
+		Cause:       cause,
+		Hint:        causeHints[cause],
+		Detail:      invalid.PrivateErr.Error(),
+		ValidatedAt: invalid.Now,
+	}
+	if p.config.Debug.DevMode {
+		diagnostic.ResponseXML = redactResponse(invalid.Response)
+	}
+	p.diagnostics.Record(diagnostic)
+}
@@ -1,50 +1,147 @@
 package saml
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"saml-poc/internal/config"
 	"saml-poc/internal/database"
 	"saml-poc/internal/models"
+	"saml-poc/internal/notify"
 )
 
+// notifyTimeout bounds the delivery of a pending-approval notification
+const notifyTimeout = 30 * time.Second
+
 // JITService handles Just-In-Time user creation
 type JITService struct {
-	userRepo *database.UserRepository
-	config   *config.JITConfig
+	userRepo  database.UserStore
+	groupRepo database.GroupStore
+	config    *config.JITConfig
+	notifier  notify.Notifier
+	cache     *DecisionCache
 }
 
-// NewJITService creates a new JIT service
-func NewJITService(userRepo *database.UserRepository, jitConfig *config.JITConfig) *JITService {
+// NewJITService creates a new JIT service. cache may be nil to disable decision caching.
+func NewJITService(userRepo database.UserStore, groupRepo database.GroupStore, jitConfig *config.JITConfig, notifier notify.Notifier, cache *DecisionCache) *JITService {
 	return &JITService{
-		userRepo: userRepo,
-		config:   jitConfig,
+		userRepo:  userRepo,
+		groupRepo: groupRepo,
+		config:    jitConfig,
+		notifier:  notifier,
+		cache:     cache,
+	}
+}
+
+// AuthorizeUserWithJIT decides whether a user may proceed, creating them if JIT is enabled.
+// Database calls are bound to ctx, so cancellations and deadlines abort the lookup
+// and are reported as an error decision. Decisions about known users are cached.
+func (j *JITService) AuthorizeUserWithJIT(ctx context.Context, attrs UserAttributes) Decision {
+	key := decisionCacheKey(attrs)
+	cached, generation, ok := j.cache.Get(key)
+	if ok {
+		return cached
+	}
+
+	decision := j.authorize(ctx, attrs)
+	if decision.Allowed() {
+		roles, err := j.userRoles(ctx, decision.User)
+		if err != nil {
+			return failure(fmt.Errorf("failed to load user roles: %w", err))
+		}
+		decision.Roles = roles
+	}
+
+	j.cache.Put(key, decision, generation)
+	return decision
+}
+
+// AuthorizeUserByID decides whether an already identified user, such as the
+// subject of an API token, may proceed. It never creates users.
+func (j *JITService) AuthorizeUserByID(ctx context.Context, userID int) Decision {
+	key := fmt.Sprintf("id\x00%d", userID)
+	cached, generation, ok := j.cache.Get(key)
+	if ok {
+		return cached
+	}
+
+	user, err := j.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return failure(fmt.Errorf("failed to get user: %w", err))
+	}
+	if user == nil {
+		return deny(nil, ReasonUnknownUser, "Your account is not authorized for this application.")
+	}
+
+	decision := decideForUser(user)
+	if decision.Allowed() {
+		roles, err := j.userRoles(ctx, user)
+		if err != nil {
+			return failure(fmt.Errorf("failed to load user roles: %w", err))
+		}
+		decision.Roles = roles
 	}
+
+	j.cache.Put(key, decision, generation)
+	return decision
 }
 
-// AuthorizeUserWithJIT checks if a user is authorized, creating them if JIT is enabled
-func (j *JITService) AuthorizeUserWithJIT(attrs UserAttributes) (bool, *models.User, error) {
+// userRoles returns the names of the groups a user belongs to
+func (j *JITService) userRoles(ctx context.Context, user *models.User) ([]string, error) {
+	if j.groupRepo == nil {
+		return nil, nil
+	}
+
+	groups, err := j.groupRepo.ListUserGroups(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]string, len(groups))
+	for i, group := range groups {
+		roles[i] = group.DisplayName
+	}
+	return roles, nil
+}
+
+// authorize makes an authorization decision from the database
+func (j *JITService) authorize(ctx context.Context, attrs UserAttributes) Decision {
+	if attrs.Email == "" && !attrs.HasPersistentNameID() {
+		log.Println("No email or persistent NameID in SAML session")
+		return deny(nil, ReasonMissingAttributes,
+			"Your identity provider did not send an email address for your account.")
+	}
+
 	// First, try to find existing user
-	user, err := j.userRepo.GetByEmail(attrs.Email)
+	user, err := j.findUser(ctx, attrs)
 	if err != nil {
-		return false, nil, fmt.Errorf("failed to get user: %w", err)
+		return failure(fmt.Errorf("failed to get user: %w", err))
 	}
 
-	// If user exists, check if they're active
+	// If user exists, their status decides
 	if user != nil {
-		if !user.IsAuthorized() {
-			log.Printf("User is inactive: %s", attrs.Email)
-			return false, user, nil
+		decision := decideForUser(user)
+		if decision.Allowed() {
+			log.Printf("Existing user authorized: %s", attrs.Email)
+		} else {
+			log.Printf("User is not active: %s (status: %s)", attrs.Email, user.Status)
 		}
-		log.Printf("Existing user authorized: %s", attrs.Email)
-		return true, user, nil
+		return decision
 	}
 
 	// User doesn't exist - check if JIT is enabled
 	if !j.config.Enabled {
 		log.Printf("User not found and JIT is disabled: %s", attrs.Email)
-		return false, nil, nil
+		return deny(nil, ReasonUnknownUser, "Your account is not authorized for this application.")
+	}
+
+	// JIT needs an email to create the account
+	if attrs.Email == "" {
+		log.Printf("JIT creation failed - no email for unlinked identity: %s", attrs.NameID)
+		return deny(nil, ReasonMissingAttributes,
+			"Your identity provider did not send an email address, so an account could not be created.")
 	}
 
 	// JIT is enabled - validate required attributes
@@ -52,7 +149,8 @@ func (j *JITService) AuthorizeUserWithJIT(attrs UserAttributes) (bool, *models.U
 		if attrs.FirstName == "" || attrs.LastName == "" {
 			log.Printf("JIT creation failed - missing required attributes for user: %s (firstName: '%s', lastName: '%s')",
 				attrs.Email, attrs.FirstName, attrs.LastName)
-			return false, nil, fmt.Errorf("missing required attributes for JIT user creation")
+			return deny(nil, ReasonMissingAttributes,
+				"Your identity provider did not send your first and last name, which are required to create your account.")
 		}
 	}
 
@@ -66,14 +164,116 @@ func (j *JITService) AuthorizeUserWithJIT(attrs UserAttributes) (bool, *models.U
 		lastName = "User"
 	}
 
+	// Evaluate provisioning policy before creating the account
+	policy := EvaluatePolicy(&j.config.Policy, attrs, j.config.DefaultUserActive)
+	if policy.Outcome == config.JITOutcomeDeny {
+		log.Printf("JIT creation denied by policy for %s (rule: '%s'): %s", attrs.Email, policy.Rule, policy.Reason)
+		return deny(nil, ReasonPolicyDenied, policy.Reason)
+	}
+
 	// Create new user via JIT
-	log.Printf("Creating new user via JIT: %s (%s %s)", attrs.Email, firstName, lastName)
-	newUser, err := j.userRepo.Create(attrs.Email, firstName, lastName, j.config.DefaultUserActive)
+	status := models.UserStatusActive
+	if policy.Outcome == config.JITOutcomeCreatePending {
+		status = models.UserStatusPending
+	}
+	log.Printf("Creating new user via JIT: %s (%s %s, status: %s)", attrs.Email, firstName, lastName, status)
+	newUser, created, err := j.userRepo.GetOrCreate(ctx, attrs.Email, firstName, lastName, status)
 	if err != nil {
 		log.Printf("JIT user creation failed for %s: %v", attrs.Email, err)
-		return false, nil, fmt.Errorf("JIT user creation failed: %w", err)
+		return failure(fmt.Errorf("JIT user creation failed: %w", err))
+	}
+
+	if !created {
+		// A concurrent first login created the account between our lookup and insert
+		log.Printf("JIT user already created by a concurrent login: %s", attrs.Email)
+		if attrs.HasPersistentNameID() {
+			if err := j.userRepo.LinkIdentity(ctx, newUser.ID, attrs.IdPEntityID, attrs.NameIDFormat, attrs.NameID); err != nil {
+				return failure(fmt.Errorf("failed to link identity for JIT user: %w", err))
+			}
+		}
+		return decideForUser(newUser)
+	}
+
+	if attrs.HasPersistentNameID() {
+		if err := j.userRepo.LinkIdentity(ctx, newUser.ID, attrs.IdPEntityID, attrs.NameIDFormat, attrs.NameID); err != nil {
+			return failure(fmt.Errorf("failed to link identity for JIT user: %w", err))
+		}
+	}
+
+	if newUser.IsPending() {
+		j.notifyPendingApproval(newUser)
 	}
 
 	log.Printf("JIT user creation successful: %s", attrs.Email)
-	return true, newUser, nil
+	return decideForUser(newUser)
+}
+
+// notifyPendingApproval notifies approvers in the background so a slow
+// webhook or mail server does not delay the login response
+func (j *JITService) notifyPendingApproval(user *models.User) {
+	if j.notifier == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		if err := j.notifier.NotifyPendingApproval(ctx, user); err != nil {
+			log.Printf("Failed to send approval notification for %s: %v", user.Email, err)
+		}
+	}()
+}
+
+// findUser looks up a user by persistent NameID first and by email second.
+// A user found by email is linked to the persistent NameID so later logins
+// still resolve to the same account if the email changes at the IdP.
+func (j *JITService) findUser(ctx context.Context, attrs UserAttributes) (*models.User, error) {
+	if attrs.HasPersistentNameID() {
+		user, err := j.userRepo.GetByIdentity(ctx, attrs.IdPEntityID, attrs.NameIDFormat, attrs.NameID)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			j.syncEmail(ctx, user, attrs.Email)
+			return user, nil
+		}
+	}
+
+	if attrs.Email == "" {
+		return nil, nil
+	}
+
+	user, err := j.userRepo.GetByEmail(ctx, attrs.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != nil && attrs.HasPersistentNameID() {
+		if err := j.userRepo.LinkIdentity(ctx, user.ID, attrs.IdPEntityID, attrs.NameIDFormat, attrs.NameID); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// syncEmail records an email change reported by the IdP for a linked user.
+// A conflict with another account is logged and the stored email is kept.
+func (j *JITService) syncEmail(ctx context.Context, user *models.User, email string) {
+	// Emails are matched normalized, so a change of case or whitespace at the IdP is not an update
+	email = models.NormalizeEmail(email)
+	if email == "" || email == models.NormalizeEmail(user.Email) {
+		return
+	}
+
+	oldEmail := user.Email
+	user.Email = email
+	if err := j.userRepo.Update(ctx, user); err != nil {
+		log.Printf("Failed to update email for user %d from %s to %s: %v", user.ID, oldEmail, email, err)
+		user.Email = oldEmail
+		return
+	}
+
+	log.Printf("Updated email for user %d from %s to %s", user.ID, oldEmail, email)
 }
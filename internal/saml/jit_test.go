@@ -0,0 +1,136 @@
+package saml
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/database"
+	"saml-poc/internal/models"
+)
+
+// slowLookupStore delays email lookups so that every concurrent login finds no
+// user before any of them creates one, which is the race GetOrCreate resolves
+type slowLookupStore struct {
+	database.UserStore
+}
+
+// GetByEmail looks the user up, then waits for the other logins to do the same
+func (s slowLookupStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.UserStore.GetByEmail(ctx, email)
+	time.Sleep(20 * time.Millisecond)
+	return user, err
+}
+
+// TestAuthorizeUserWithJITConcurrentFirstLogin signs in one new user from many
+// goroutines at once, as happens when a user opens several tabs after their
+// first SAML login. Every login must succeed and resolve to a single account.
+func TestAuthorizeUserWithJITConcurrentFirstLogin(t *testing.T) {
+	const logins = 50
+
+	stores := []struct {
+		name string
+		// open returns the store and, for SQL stores, a function counting rows
+		open func(t *testing.T) (store database.UserStore, count func(query string, args ...interface{}) int)
+	}{
+		{"memory", func(t *testing.T) (database.UserStore, func(string, ...interface{}) int) {
+			return database.NewMemoryUserStore(), nil
+		}},
+		{"sqlite", func(t *testing.T) (database.UserStore, func(string, ...interface{}) int) {
+			db, err := database.New(database.DriverSQLite, filepath.Join(t.TempDir(), "jit.db"), database.Options{})
+			if err != nil {
+				t.Fatalf("failed to open SQLite database: %v", err)
+			}
+			t.Cleanup(func() { db.Close() })
+
+			count := func(query string, args ...interface{}) int {
+				var n int
+				if err := db.GetConnection().QueryRow(query, args...).Scan(&n); err != nil {
+					t.Fatalf("failed to count rows: %v", err)
+				}
+				return n
+			}
+			return database.NewUserRepository(db), count
+		}},
+	}
+
+	attrs := UserAttributes{
+		Email:        "New.User@Example.com",
+		FirstName:    "New",
+		LastName:     "User",
+		NameID:       "new-user-1234",
+		NameIDFormat: "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+		IdPEntityID:  "https://idp.example.com",
+	}
+
+	// Emails are stored normalized
+	const email = "new.user@example.com"
+
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			store, count := tc.open(t)
+			jit := NewJITService(slowLookupStore{store}, nil, &config.JITConfig{Enabled: true, DefaultUserActive: true}, nil, nil)
+
+			decisions := make([]Decision, logins)
+			var start, done sync.WaitGroup
+			start.Add(1)
+			for i := 0; i < logins; i++ {
+				done.Add(1)
+				go func(i int) {
+					defer done.Done()
+					start.Wait()
+					decisions[i] = jit.AuthorizeUserWithJIT(context.Background(), attrs)
+				}(i)
+			}
+			start.Done()
+			done.Wait()
+
+			userID := 0
+			for i, decision := range decisions {
+				if !decision.Allowed() {
+					t.Fatalf("login %d was not allowed: %s", i, decision)
+				}
+				if userID == 0 {
+					userID = decision.User.ID
+				} else if decision.User.ID != userID {
+					t.Fatalf("login %d resolved to user %d, want %d", i, decision.User.ID, userID)
+				}
+			}
+
+			// The SQLite migrations seed sample users, so only count this one
+			users, err := store.List(context.Background(), 1000, 0)
+			if err != nil {
+				t.Fatalf("failed to list users: %v", err)
+			}
+			matching := 0
+			for _, user := range users {
+				if user.Email == email {
+					matching++
+				}
+			}
+			if matching != 1 {
+				t.Fatalf("got %d users for %s, want 1", matching, email)
+			}
+
+			linked, err := store.GetByIdentity(context.Background(), attrs.IdPEntityID, attrs.NameIDFormat, attrs.NameID)
+			if err != nil {
+				t.Fatalf("failed to look up identity: %v", err)
+			}
+			if linked == nil || linked.ID != userID {
+				t.Fatalf("identity is linked to %v, want user %d", linked, userID)
+			}
+
+			if count != nil {
+				if n := count(`SELECT COUNT(*) FROM users WHERE LOWER(email) = $1`, email); n != 1 {
+					t.Fatalf("got %d users rows, want 1", n)
+				}
+				if n := count(`SELECT COUNT(*) FROM user_identities WHERE user_id = $1`, userID); n != 1 {
+					t.Fatalf("got %d user_identities rows, want 1", n)
+				}
+			}
+		})
+	}
+}
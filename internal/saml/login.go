@@ -0,0 +1,99 @@
+package saml
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+// LoginPath starts SAML sign-in; the rd query parameter is the URL to return to afterwards
+const LoginPath = "/saml/sso"
+
+// HandleLogin starts the SAML sign-in flow and returns the user to the URL in
+// the rd query parameter once signed in. Targets outside the redirect
+// allowlist fall back to the default page.
+func (p *Provider) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	target := p.redirectTarget(r, r.URL.Query().Get("rd"))
+
+	// The SAML request tracker remembers the request URL as the page to return to
+	start := r.Clone(r.Context())
+	start.URL = target
+	p.startAuthFlow(w, start)
+}
+
+// RequireAccount serves handler to requests with a SAML session and sends
+// everyone else to the IdP. It replaces samlsp's RequireAccount so that the
+// AuthnRequests it sends can be traced.
+func (p *Provider) RequireAccount(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := p.SP.Session.GetSession(r)
+		if session != nil {
+			handler.ServeHTTP(w, r.WithContext(samlsp.ContextWithSession(r.Context(), session)))
+			return
+		}
+		if err == samlsp.ErrNoSession {
+			p.startAuthFlow(w, r)
+			return
+		}
+
+		p.SP.OnError(w, r, err)
+	})
+}
+
+// startAuthFlow sends the user to the IdP with an AuthnRequest, as
+// samlsp.Middleware.HandleStartAuthFlow does, remembering r's URL as the page
+// to return to
+func (p *Provider) startAuthFlow(w http.ResponseWriter, r *http.Request) {
+	m := p.SP
+	if r.URL.Path == m.ServiceProvider.AcsURL.Path {
+		// Starting a sign-in from the ACS would loop
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	binding := m.Binding
+	if binding == "" {
+		binding = saml.HTTPRedirectBinding
+		if m.ServiceProvider.GetSSOBindingLocation(binding) == "" {
+			binding = saml.HTTPPostBinding
+		}
+	}
+
+	authReq, err := m.ServiceProvider.MakeAuthenticationRequest(m.ServiceProvider.GetSSOBindingLocation(binding), binding, m.ResponseBinding)
+	if err != nil {
+		m.OnError(w, r, err)
+		return
+	}
+
+	// The tracker signs a cookie holding the request URL; RelayState only refers to it
+	relayState, err := m.RequestTracker.TrackRequest(w, r, authReq.ID)
+	if err != nil {
+		m.OnError(w, r, err)
+		return
+	}
+	p.traceAuthnRequest(r, authReq, binding)
+
+	if binding == saml.HTTPRedirectBinding {
+		redirectURL, err := authReq.Redirect(relayState, &m.ServiceProvider)
+		if err != nil {
+			m.OnError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+		return
+	}
+
+	// The hash allows samlsp's inline script that submits the form
+	w.Header().Add("Content-Security-Policy", ""+
+		"default-src; "+
+		"script-src 'sha256-AjPdJSbZmeWHnEc5ykvJFay8FTWeTeRbs9dutfZ0HqE='; "+
+		"reflected-xss block; referrer no-referrer;")
+	w.Header().Set("Content-Type", "text/html")
+	var buf bytes.Buffer
+	buf.WriteString(`<!DOCTYPE html><html><body>`)
+	buf.Write(authReq.Post(relayState))
+	buf.WriteString(`</body></html>`)
+	w.Write(buf.Bytes())
+}
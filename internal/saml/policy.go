@@ -0,0 +1,101 @@
+package saml
+
+import (
+	"fmt"
+	"strings"
+
+	"saml-poc/internal/config"
+)
+
+// PolicyDecision is the result of evaluating the JIT provisioning policy
+type PolicyDecision struct {
+	Outcome string // one of the config.JITOutcome* values
+	Rule    string // name of the deciding rule, empty for domain lists and the default
+	Reason  string // user-facing explanation for denials
+}
+
+// EvaluatePolicy decides whether and how a new user may be provisioned.
+// Blocked domains are checked first, then allowed domains, then rules in order.
+func EvaluatePolicy(policy *config.JITPolicy, attrs UserAttributes, defaultActive bool) PolicyDecision {
+	domain := emailDomain(attrs.Email)
+
+	if containsFold(policy.BlockedDomains, domain) {
+		return PolicyDecision{
+			Outcome: config.JITOutcomeDeny,
+			Reason:  fmt.Sprintf("Accounts from %s are not permitted.", domain),
+		}
+	}
+
+	if len(policy.AllowedDomains) > 0 && !containsFold(policy.AllowedDomains, domain) {
+		return PolicyDecision{
+			Outcome: config.JITOutcomeDeny,
+			Reason:  fmt.Sprintf("Accounts from %s are not permitted.", domain),
+		}
+	}
+
+	for _, rule := range policy.Rules {
+		if !ruleMatches(rule, attrs, domain) {
+			continue
+		}
+
+		decision := PolicyDecision{Outcome: rule.Outcome, Rule: rule.Name, Reason: rule.Reason}
+		if decision.Outcome == config.JITOutcomeDeny && decision.Reason == "" {
+			decision.Reason = "Your account does not meet the requirements for access."
+		}
+		return decision
+	}
+
+	switch {
+	case policy.DefaultOutcome == config.JITOutcomeDeny:
+		return PolicyDecision{
+			Outcome: config.JITOutcomeDeny,
+			Reason:  "Your account does not meet the requirements for access.",
+		}
+	case policy.DefaultOutcome != "":
+		return PolicyDecision{Outcome: policy.DefaultOutcome}
+	case defaultActive:
+		return PolicyDecision{Outcome: config.JITOutcomeCreateActive}
+	default:
+		return PolicyDecision{Outcome: config.JITOutcomeCreatePending}
+	}
+}
+
+// ruleMatches reports whether all of a rule's conditions hold
+func ruleMatches(rule config.JITRule, attrs UserAttributes, domain string) bool {
+	if len(rule.EmailDomains) > 0 && !containsFold(rule.EmailDomains, domain) {
+		return false
+	}
+
+	for name, want := range rule.Attributes {
+		if !containsFold(attrs.Raw[name], want) {
+			return false
+		}
+	}
+
+	for _, group := range rule.Groups {
+		if !containsFold(attrs.Groups, group) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// emailDomain returns the lowercased domain part of an email address
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// containsFold reports whether values contains target, ignoring case
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
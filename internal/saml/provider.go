@@ -13,16 +13,24 @@ import (
 	"github.com/crewjam/saml/samlsp"
 
 	"saml-poc/internal/config"
+	"saml-poc/internal/views"
 )
 
 // Provider wraps SAML service provider functionality
 type Provider struct {
 	SP     *samlsp.Middleware
 	config *config.Config
+	views  *views.Renderer
+	// diagnostics records rejected SAML responses and traces the messages
+	// exchanged with the IdP; either may be nil to record nothing
+	diagnostics *DiagnosticsStore
+	traces      *TraceStore
 }
 
-// NewProvider creates a new SAML provider
-func NewProvider(cfg *config.Config) (*Provider, error) {
+// NewProvider creates a new SAML provider; v renders the pages shown when sign-in
+// fails, diagnostics records why SAML responses were rejected and traces records
+// the SAML messages exchanged. Both stores may be nil.
+func NewProvider(cfg *config.Config, v *views.Renderer, diagnostics *DiagnosticsStore, traces *TraceStore) (*Provider, error) {
 	// Load IdP metadata
 	idpMetadata, err := loadIdpMetadata(cfg.SAML.IdPMetadataPath)
 	if err != nil {
@@ -59,15 +67,33 @@ func NewProvider(cfg *config.Config) (*Provider, error) {
 		IDPMetadata: idpMetadata,
 		EntityID:    cfg.SAML.EntityID,
 		SignRequest: true,
+
+		AllowIDPInitiated:  cfg.SAML.AllowIdPInitiated,
+		DefaultRedirectURI: cfg.SAML.DefaultRedirect,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SAML SP: %w", err)
 	}
 
-	return &Provider{
+	// Keep the NameID format and IdP entity ID in the session for identity linking
+	if sessions, ok := samlSP.Session.(samlsp.CookieSessionProvider); ok {
+		if codec, ok := sessions.Codec.(samlsp.JWTSessionCodec); ok {
+			sessions.Codec = identitySessionCodec{JWTSessionCodec: codec}
+			samlSP.Session = sessions
+		}
+	}
+
+	provider := &Provider{
 		SP:     samlSP,
 		config: cfg,
-	}, nil
+		views:  v,
+
+		diagnostics: diagnostics,
+		traces:      traces,
+	}
+	samlSP.OnError = provider.onError
+
+	return provider, nil
 }
 
 // GetMiddleware returns the SAML middleware
@@ -75,6 +101,14 @@ func (p *Provider) GetMiddleware() *samlsp.Middleware {
 	return p.SP
 }
 
+// SessionCookieName returns the name of the SAML session cookie
+func (p *Provider) SessionCookieName() string {
+	if sessions, ok := p.SP.Session.(samlsp.CookieSessionProvider); ok {
+		return sessions.Name
+	}
+	return "token"
+}
+
 // loadIdpMetadata loads IdP metadata from file
 func loadIdpMetadata(path string) (*saml.EntityDescriptor, error) {
 	metadataXML, err := ioutil.ReadFile(path)
@@ -0,0 +1,81 @@
+package saml
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redirectTarget validates a post-login redirect against the allowlist in
+// SAML_REDIRECT_PATHS and SAML_REDIRECT_HOSTS, guarding against open
+// redirects. Invalid or untrusted targets are replaced by the default page.
+func (p *Provider) redirectTarget(r *http.Request, raw string) *url.URL {
+	fallback := &url.URL{Path: p.config.SAML.DefaultRedirect}
+	if raw == "" {
+		return fallback
+	}
+
+	target, err := url.Parse(raw)
+	if err != nil || strings.ContainsAny(raw, "\\\r\n") {
+		log.Printf("Ignoring invalid login redirect: %q", raw)
+		return fallback
+	}
+
+	if !target.IsAbs() && target.Host == "" {
+		if !p.isRedirectPath(target.Path) {
+			log.Printf("Refusing login redirect to path outside the allowlist: %q", raw)
+			return fallback
+		}
+		return &url.URL{Path: target.Path, RawPath: target.RawPath, RawQuery: target.RawQuery}
+	}
+
+	if target.Scheme != "http" && target.Scheme != "https" {
+		log.Printf("Refusing login redirect with scheme %q", target.Scheme)
+		return fallback
+	}
+
+	// Absolute URLs on this server are held to the path allowlist; other hosts must be listed
+	if p.isOwnHost(r, target.Host) {
+		if !p.isRedirectPath(target.Path) {
+			log.Printf("Refusing login redirect to path outside the allowlist: %q", raw)
+			return fallback
+		}
+		return target
+	}
+	if p.isRedirectHost(target.Host) {
+		return target
+	}
+
+	log.Printf("Refusing login redirect to untrusted host: %q", raw)
+	return fallback
+}
+
+// isRedirectPath reports whether a path on this server may be returned to.
+// SAML endpoints are never allowed, since returning to them would loop.
+func (p *Provider) isRedirectPath(path string) bool {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/saml/") {
+		return false
+	}
+	for _, prefix := range p.config.SAML.RedirectPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOwnHost reports whether host is this server
+func (p *Provider) isOwnHost(r *http.Request, host string) bool {
+	return strings.EqualFold(host, r.Host) || strings.EqualFold(host, p.config.ServerAddress())
+}
+
+// isRedirectHost reports whether users may be sent to another host after signing in
+func (p *Provider) isRedirectHost(host string) bool {
+	for _, allowed := range p.config.SAML.RedirectHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package saml
+
+import "sync"
+
+// ring keeps the most recent items up to a fixed size
+type ring[T any] struct {
+	mu    sync.Mutex
+	items []T
+	size  int
+}
+
+// newRing creates a ring keeping up to size items
+func newRing[T any](size int) *ring[T] {
+	return &ring[T]{size: size}
+}
+
+// add appends an item, dropping the oldest when the ring is full
+func (r *ring[T]) add(item T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.items) == r.size {
+		r.items = r.items[1:]
+	}
+	r.items = append(r.items, item)
+}
+
+// recent returns the items, newest first
+func (r *ring[T]) recent() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recent := make([]T, len(r.items))
+	for i, item := range r.items {
+		recent[len(r.items)-1-i] = item
+	}
+	return recent
+}
@@ -0,0 +1,168 @@
+// Package samltest provides a SAML identity provider for tests that sign in
+// through the service provider's ACS endpoint.
+package samltest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	crewsaml "github.com/crewjam/saml"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/saml"
+)
+
+// ACSURL is the assertion consumer service of the configuration returned by NewConfig
+const ACSURL = "http://localhost:8080/saml/acs"
+
+// IdP signs SAML responses for the service provider under test
+type IdP struct {
+	idp *crewsaml.IdentityProvider
+	sp  *crewsaml.EntityDescriptor
+}
+
+// NewConfig writes an SP key pair and the metadata of a new test IdP, and
+// returns a configuration accepting IdP-initiated logins from it. Call Trust
+// with the provider built from the configuration before making responses.
+func NewConfig(t testing.TB) (*config.Config, *IdP) {
+	t.Helper()
+	dir := t.TempDir()
+
+	spKey, spCert := newKeyPair(t, "sp")
+	certFile := writeFile(t, dir, "sp.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: spCert.Raw}))
+	keyFile := writeFile(t, dir, "sp.key", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(spKey)}))
+
+	idpKey, idpCert := newKeyPair(t, "idp")
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	idp := &crewsaml.IdentityProvider{
+		Key:         idpKey,
+		Certificate: idpCert,
+		MetadataURL: *metadataURL,
+		SSOURL:      *ssoURL,
+	}
+	metadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatalf("failed to marshal IdP metadata: %v", err)
+	}
+
+	cfg := &config.Config{
+		Server:   config.ServerConfig{Host: "localhost", Port: "8080"},
+		Database: config.DatabaseConfig{QueryTimeout: 10 * time.Second},
+		SAML: config.SAMLConfig{
+			EntityID:          "http://localhost:8080/saml/metadata",
+			IdPMetadataPath:   writeFile(t, dir, "idp-metadata.xml", metadata),
+			CertFile:          certFile,
+			KeyFile:           keyFile,
+			AllowIdPInitiated: true,
+			DefaultRedirect:   "/home",
+			RedirectPaths:     []string{"/"},
+		},
+		JIT: config.JITConfig{Enabled: true, DefaultUserActive: true},
+	}
+	return cfg, &IdP{idp: idp}
+}
+
+// Trust registers the service provider of p with the IdP
+func (p *IdP) Trust(provider *saml.Provider) {
+	p.sp = provider.GetMiddleware().ServiceProvider.Metadata()
+}
+
+// Response returns the form fields of an IdP-initiated SAML response with a
+// persistent nameID and the given attributes
+func (p *IdP) Response(t testing.TB, nameID string, attributes map[string]string) url.Values {
+	t.Helper()
+	spsso := p.sp.SPSSODescriptors[0]
+	req := &crewsaml.IdpAuthnRequest{
+		IDP:                     p.idp,
+		HTTPRequest:             httptest.NewRequest(http.MethodGet, p.idp.SSOURL.String(), nil),
+		Now:                     crewsaml.TimeNow(),
+		ServiceProviderMetadata: p.sp,
+		SPSSODescriptor:         &spsso,
+		ACSEndpoint:             &spsso.AssertionConsumerServices[0],
+	}
+
+	session := &crewsaml.Session{
+		ID:           "session-" + nameID,
+		CreateTime:   crewsaml.TimeNow(),
+		ExpireTime:   crewsaml.TimeNow().Add(time.Hour),
+		NameID:       nameID,
+		NameIDFormat: saml.NameIDFormatPersistent,
+	}
+	for name, value := range attributes {
+		session.CustomAttributes = append(session.CustomAttributes, crewsaml.Attribute{
+			Name:       name,
+			NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+			Values:     []crewsaml.AttributeValue{{Type: "xs:string", Value: value}},
+		})
+	}
+
+	if err := (crewsaml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		t.Fatalf("failed to make assertion: %v", err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatalf("failed to make SAML response: %v", err)
+	}
+	return url.Values{"SAMLResponse": {form.SAMLResponse}}
+}
+
+// SignIn posts a SAML response to the ACS served by handler and returns the session cookies it sets
+func SignIn(handler http.Handler, form url.Values) ([]*http.Cookie, error) {
+	req := httptest.NewRequest(http.MethodPost, ACSURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		return nil, fmt.Errorf("ACS returned %d: %s", rec.Code, rec.Body)
+	}
+	return rec.Result().Cookies(), nil
+}
+
+// newKeyPair generates an RSA key and a self-signed certificate for it
+func newKeyPair(t testing.TB, name string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate %s key: %v", name, err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create %s certificate: %v", name, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse %s certificate: %v", name, err)
+	}
+	return key, cert
+}
+
+// writeFile writes data to name in dir and returns its path
+func writeFile(t testing.TB, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
@@ -0,0 +1,40 @@
+package saml
+
+import (
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+// Session attributes recorded alongside the IdP-provided attributes so the
+// external identity (IdP entity ID, NameID format, NameID) survives in the session cookie
+const (
+	SessionAttrNameIDFormat = "saml:NameIDFormat"
+	SessionAttrIdPEntityID  = "saml:IdPEntityID"
+)
+
+// NameIDFormatPersistent identifies a stable, pairwise NameID that can be linked to an account
+const NameIDFormatPersistent = string(saml.PersistentNameIDFormat)
+
+// identitySessionCodec extends the default JWT session codec with the assertion's
+// NameID format and issuer, which samlsp otherwise discards
+type identitySessionCodec struct {
+	samlsp.JWTSessionCodec
+}
+
+// New creates a session from the SAML assertion, recording identity details
+func (c identitySessionCodec) New(assertion *saml.Assertion) (samlsp.Session, error) {
+	session, err := c.JWTSessionCodec.New(assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := session.(samlsp.JWTSessionClaims)
+	if sub := assertion.Subject; sub != nil && sub.NameID != nil && sub.NameID.Format != "" {
+		claims.Attributes[SessionAttrNameIDFormat] = []string{sub.NameID.Format}
+	}
+	if assertion.Issuer.Value != "" {
+		claims.Attributes[SessionAttrIdPEntityID] = []string{assertion.Issuer.Value}
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,234 @@
+package saml
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+
+	"saml-poc/internal/requestid"
+)
+
+// SAML message kinds recorded in a trace
+const (
+	TraceAuthnRequest = "AuthnRequest"
+	TraceResponse     = "Response"
+)
+
+// Trace is one SAML message exchanged with the IdP, decoded for troubleshooting
+type Trace struct {
+	Time time.Time `json:"time"`
+	// RequestID is the support reference of the HTTP request that carried the message
+	RequestID    string `json:"request_id"`
+	Kind         string `json:"kind"`
+	Binding      string `json:"binding,omitempty"`
+	ID           string `json:"id,omitempty"`
+	InResponseTo string `json:"in_response_to,omitempty"`
+	Destination  string `json:"destination,omitempty"`
+	Issuer       string `json:"issuer,omitempty"`
+	// Signature describes which parts of the message are signed
+	Signature string `json:"signature"`
+	// Result is "sent" for requests and "valid" or the rejection cause for responses
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	// StatusCode is the IdP's status for responses
+	StatusCode string              `json:"status_code,omitempty"`
+	NameID     string              `json:"name_id,omitempty"`
+	Conditions *TraceConditions    `json:"conditions,omitempty"`
+	Attributes map[string][]string `json:"attributes,omitempty"`
+	// XML is the pretty-printed message
+	XML string `json:"xml"`
+}
+
+// TraceConditions are the validity conditions of an assertion
+type TraceConditions struct {
+	NotBefore    time.Time `json:"not_before"`
+	NotOnOrAfter time.Time `json:"not_on_or_after"`
+	Audiences    []string  `json:"audiences,omitempty"`
+}
+
+// TraceStore keeps the most recent SAML messages in memory
+type TraceStore struct {
+	traces *ring[Trace]
+}
+
+// NewTraceStore creates a store keeping up to max messages.
+// It returns nil, which records nothing, when max is not positive.
+func NewTraceStore(max int) *TraceStore {
+	if max <= 0 {
+		return nil
+	}
+	return &TraceStore{traces: newRing[Trace](max)}
+}
+
+// Record adds a message, dropping the oldest when the store is full
+func (s *TraceStore) Record(t Trace) {
+	if s == nil {
+		return
+	}
+	s.traces.add(t)
+}
+
+// Recent returns the recorded messages, newest first
+func (s *TraceStore) Recent() []Trace {
+	if s == nil {
+		return nil
+	}
+	return s.traces.recent()
+}
+
+// traceAuthnRequest records an AuthnRequest sent to the IdP
+func (p *Provider) traceAuthnRequest(r *http.Request, req *saml.AuthnRequest, binding string) {
+	if p.traces == nil {
+		return
+	}
+
+	signature := "unsigned"
+	switch {
+	case req.Signature != nil:
+		signature = "signed (XML signature)"
+	case binding == saml.HTTPRedirectBinding && p.SP.ServiceProvider.SignatureMethod != "":
+		signature = "signed (query string signature)"
+	}
+
+	trace := Trace{
+		Time:        time.Now(),
+		RequestID:   requestid.FromContext(r.Context()),
+		Kind:        TraceAuthnRequest,
+		Binding:     binding,
+		ID:          req.ID,
+		Destination: req.Destination,
+		Signature:   signature,
+		Result:      "sent",
+	}
+	if req.Issuer != nil {
+		trace.Issuer = req.Issuer.Value
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(req.Element())
+	trace.XML = prettyXML(doc)
+
+	p.traces.Record(trace)
+}
+
+// traceResponse records a SAML response received at the ACS. assertion is
+// the validated assertion, or nil when validation failed with err.
+func (p *Provider) traceResponse(r *http.Request, assertion *saml.Assertion, err error) {
+	if p.traces == nil {
+		return
+	}
+
+	trace := Trace{
+		Time:      time.Now(),
+		RequestID: requestid.FromContext(r.Context()),
+		Kind:      TraceResponse,
+		Binding:   saml.HTTPPostBinding,
+		Result:    "valid",
+		Signature: "unsigned",
+	}
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		trace.Result = ClassifyResponseError(err)
+		trace.Error = err.Error()
+	}
+
+	raw, decodeErr := base64.StdEncoding.DecodeString(r.PostForm.Get("SAMLResponse"))
+	if decodeErr != nil || len(raw) == 0 {
+		trace.XML = "(no decodable SAMLResponse in the request)"
+		p.traces.Record(trace)
+		return
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		trace.XML = truncateXML(string(raw))
+	} else {
+		trace.XML = prettyXML(doc)
+	}
+
+	// The envelope is read as sent; the assertion prefers the validated, decrypted one
+	var response saml.Response
+	if err := xml.Unmarshal(raw, &response); err == nil {
+		trace.ID = response.ID
+		trace.InResponseTo = response.InResponseTo
+		trace.Destination = response.Destination
+		if response.Issuer != nil {
+			trace.Issuer = response.Issuer.Value
+		}
+		trace.StatusCode = response.Status.StatusCode.Value
+		trace.Signature = responseSignature(&response)
+		if assertion == nil {
+			assertion = response.Assertion
+		}
+	}
+	if assertion != nil {
+		summarizeAssertion(&trace, assertion)
+	}
+
+	p.traces.Record(trace)
+}
+
+// responseSignature describes which parts of a response carry a signature
+func responseSignature(response *saml.Response) string {
+	responseSigned := response.Signature != nil
+	assertionSigned := response.Assertion != nil && response.Assertion.Signature != nil
+	switch {
+	case response.EncryptedAssertion != nil && responseSigned:
+		return "response signed, assertion encrypted"
+	case response.EncryptedAssertion != nil:
+		return "assertion encrypted"
+	case responseSigned && assertionSigned:
+		return "response and assertion signed"
+	case responseSigned:
+		return "response signed"
+	case assertionSigned:
+		return "assertion signed"
+	}
+	return "unsigned"
+}
+
+// summarizeAssertion copies the subject, conditions and attributes of an assertion into a trace
+func summarizeAssertion(trace *Trace, assertion *saml.Assertion) {
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		trace.NameID = assertion.Subject.NameID.Value
+	}
+
+	if conditions := assertion.Conditions; conditions != nil {
+		trace.Conditions = &TraceConditions{
+			NotBefore:    conditions.NotBefore,
+			NotOnOrAfter: conditions.NotOnOrAfter,
+		}
+		for _, restriction := range conditions.AudienceRestrictions {
+			trace.Conditions.Audiences = append(trace.Conditions.Audiences, restriction.Audience.Value)
+		}
+	}
+
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if trace.Attributes == nil {
+				trace.Attributes = make(map[string][]string)
+			}
+			for _, value := range attr.Values {
+				trace.Attributes[attr.Name] = append(trace.Attributes[attr.Name], value.Value)
+			}
+		}
+	}
+}
+
+// prettyXML indents a SAML message for display
+func prettyXML(doc *etree.Document) string {
+	doc.Indent(2)
+	text, err := doc.WriteToString()
+	if err != nil {
+		return "(could not serialise message: " + err.Error() + ")"
+	}
+	return truncateXML(text)
+}
@@ -0,0 +1,252 @@
+package scim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// attributeSet holds a resource's filterable attribute values, keyed by
+// lower-case attribute path (e.g. "username", "name.givenname", "emails.value")
+type attributeSet map[string][]string
+
+// filter matches resources against a SCIM filter expression
+type filter interface {
+	match(attrs attributeSet) bool
+}
+
+// comparison is a single "attrPath op value" or "attrPath pr" expression
+type comparison struct {
+	path  string
+	op    string
+	value string
+}
+
+// logical joins two filters with "and" or "or"
+type logical struct {
+	and         bool
+	left, right filter
+}
+
+func (l logical) match(attrs attributeSet) bool {
+	if l.and {
+		return l.left.match(attrs) && l.right.match(attrs)
+	}
+	return l.left.match(attrs) || l.right.match(attrs)
+}
+
+// match compares case-insensitively, as all supported attributes have caseExact=false
+func (c comparison) match(attrs attributeSet) bool {
+	values := attrs[c.path]
+	if c.op == "pr" {
+		for _, v := range values {
+			if v != "" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if c.op == "ne" {
+		for _, v := range values {
+			if strings.EqualFold(v, c.value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	want := strings.ToLower(c.value)
+	for _, v := range values {
+		v = strings.ToLower(v)
+		switch c.op {
+		case "eq":
+			if v == want {
+				return true
+			}
+		case "co":
+			if strings.Contains(v, want) {
+				return true
+			}
+		case "sw":
+			if strings.HasPrefix(v, want) {
+				return true
+			}
+		case "ew":
+			if strings.HasSuffix(v, want) {
+				return true
+			}
+		case "gt":
+			if v > want {
+				return true
+			}
+		case "ge":
+			if v >= want {
+				return true
+			}
+		case "lt":
+			if v < want {
+				return true
+			}
+		case "le":
+			if v <= want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equalityOn returns the value of a top-level "path eq value" filter, so list
+// requests for a single user or group can use an indexed lookup
+func equalityOn(f filter, path string) (string, bool) {
+	c, ok := f.(comparison)
+	if !ok || c.op != "eq" || c.path != path {
+		return "", false
+	}
+	return c.value, true
+}
+
+// parseFilter parses a SCIM filter. Supported: comparisons with eq, ne, co, sw,
+// ew, gt, ge, lt, le and pr, joined by "and"/"or" ("and" binds tighter).
+// Parentheses, "not" and value paths (emails[type eq "work"]) are not supported.
+func parseFilter(expr string) (filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in filter", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+// filterToken is a word or quoted string in a filter
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeFilter splits a filter on whitespace, keeping quoted strings intact
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		switch {
+		case expr[i] == ' ' || expr[i] == '\t':
+			i++
+		case expr[i] == '"':
+			var value strings.Builder
+			i++
+			for ; i < len(expr) && expr[i] != '"'; i++ {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					i++
+				}
+				value.WriteByte(expr[i])
+			}
+			if i >= len(expr) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+			i++
+			tokens = append(tokens, filterToken{text: value.String(), quoted: true})
+		case expr[i] == '(' || expr[i] == ')' || expr[i] == '[' || expr[i] == ']':
+			return nil, fmt.Errorf("grouping is not supported in filters")
+		default:
+			start := i
+			for i < len(expr) && expr[i] != ' ' && expr[i] != '\t' && expr[i] != '"' {
+				i++
+			}
+			tokens = append(tokens, filterToken{text: expr[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser is a recursive-descent parser over filter tokens
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// keyword consumes the next token if it is the given case-insensitive keyword
+func (p *filterParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filter, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseComparison() (filter, error) {
+	if p.pos+1 >= len(p.tokens) {
+		return nil, fmt.Errorf("incomplete filter expression")
+	}
+
+	c := comparison{
+		path: normalizePath(p.tokens[p.pos].text),
+		op:   strings.ToLower(p.tokens[p.pos+1].text),
+	}
+	p.pos += 2
+
+	switch c.op {
+	case "pr":
+		return c, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unsupported filter operator %q", c.op)
+	}
+
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("missing value for %s %s", c.path, c.op)
+	}
+	c.value = p.tokens[p.pos].text
+	p.pos++
+	return c, nil
+}
+
+// normalizePath lower-cases an attribute path and strips a schema URN prefix
+func normalizePath(path string) string {
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if len(path) > len(schema) && strings.EqualFold(path[:len(schema)+1], schema+":") {
+			path = path[len(schema)+1:]
+		}
+	}
+	return strings.ToLower(path)
+}
@@ -0,0 +1,277 @@
+package scim
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"saml-poc/internal/models"
+)
+
+// serveGroups dispatches /Groups and /Groups/{id} requests
+func (h *Handler) serveGroups(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) {
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.listGroups(ctx, w, r)
+		case http.MethodPost:
+			h.createGroup(ctx, w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		}
+		return
+	}
+
+	groupID, ok := parseID(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "Group not found")
+		return
+	}
+
+	group, err := h.groups.GetGroup(ctx, groupID)
+	if err != nil {
+		writeStoreError(ctx, w, "load group", err)
+		return
+	}
+	if group == nil {
+		writeError(w, http.StatusNotFound, "", "Group not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, newGroupResource(baseURL(r), group, includeMembers(r)))
+	case http.MethodPut:
+		h.replaceGroup(ctx, w, r, group)
+	case http.MethodPatch:
+		h.patchGroup(ctx, w, r, group)
+	case http.MethodDelete:
+		if err := h.groups.DeleteGroup(ctx, group.ID); err != nil {
+			writeStoreError(ctx, w, "delete group", err)
+			return
+		}
+		log.Printf("SCIM deleted group: %s", group.DisplayName)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+	}
+}
+
+// includeMembers reports whether the client did not exclude the members attribute,
+// which large groups commonly do when only checking for existence
+func includeMembers(r *http.Request) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if normalizePath(strings.TrimSpace(attr)) == "members" {
+			return false
+		}
+	}
+	return true
+}
+
+// listGroups returns groups matching the optional filter
+func (h *Handler) listGroups(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	params, err := parseListParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	var groups []*models.Group
+	if name, ok := equalityOn(params.filter, "displayname"); ok {
+		group, err := h.groups.GetGroupByName(ctx, name)
+		if err != nil {
+			writeStoreError(ctx, w, "look up group", err)
+			return
+		}
+		if group != nil {
+			groups = append(groups, group)
+		}
+	} else {
+		for offset := 0; ; offset += listBatchSize {
+			batch, err := h.groups.ListGroups(ctx, listBatchSize, offset)
+			if err != nil {
+				writeStoreError(ctx, w, "list groups", err)
+				return
+			}
+			groups = append(groups, batch...)
+			if len(batch) < listBatchSize {
+				break
+			}
+		}
+	}
+
+	var matched []*models.Group
+	for _, group := range groups {
+		if params.filter == nil || params.filter.match(groupAttributes(group)) {
+			matched = append(matched, group)
+		}
+	}
+
+	start, end := params.page(len(matched))
+	base := baseURL(r)
+	withMembers := includeMembers(r)
+	resources := make([]groupResource, 0, end-start)
+	for _, group := range matched[start:end] {
+		resources = append(resources, newGroupResource(base, group, withMembers))
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(matched),
+		StartIndex:   params.startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// createGroup creates a group with its initial members
+func (h *Handler) createGroup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var input groupInput
+	if err := decodeBody(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	if input.DisplayName == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+
+	members, err := memberIDs(input.Members)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	if !h.checkMembers(ctx, w, members) {
+		return
+	}
+
+	existing, err := h.groups.GetGroupByName(ctx, input.DisplayName)
+	if err != nil {
+		writeStoreError(ctx, w, "look up group", err)
+		return
+	}
+	if existing != nil {
+		writeError(w, http.StatusConflict, "uniqueness", "A group with this displayName already exists")
+		return
+	}
+
+	group, err := h.groups.CreateGroup(ctx, input.DisplayName, unionIDs(nil, members))
+	if err != nil {
+		writeStoreError(ctx, w, "create group", err)
+		return
+	}
+
+	resource := newGroupResource(baseURL(r), group, true)
+	w.Header().Set("Location", resource.Meta.Location)
+	writeJSON(w, http.StatusCreated, resource)
+}
+
+// replaceGroup replaces a group's display name and members (PUT)
+func (h *Handler) replaceGroup(ctx context.Context, w http.ResponseWriter, r *http.Request, group *models.Group) {
+	var input groupInput
+	if err := decodeBody(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	members, err := memberIDs(input.Members)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	updated := *group
+	if input.DisplayName != "" {
+		updated.DisplayName = input.DisplayName
+	}
+	updated.MemberIDs = unionIDs(nil, members)
+
+	h.saveGroup(ctx, w, r, group, &updated)
+}
+
+// patchGroup applies PATCH operations to a group
+func (h *Handler) patchGroup(ctx context.Context, w http.ResponseWriter, r *http.Request, group *models.Group) {
+	var patch patchRequest
+	if err := decodeBody(r, &patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	updated := *group
+	updated.MemberIDs = append([]int(nil), group.MemberIDs...)
+	if err := applyGroupPatch(&updated, patch.Operations); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	h.saveGroup(ctx, w, r, group, &updated)
+}
+
+// saveGroup persists the differences between a group and its updated copy
+func (h *Handler) saveGroup(ctx context.Context, w http.ResponseWriter, r *http.Request, group, updated *models.Group) {
+	if updated.DisplayName == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+
+	added := subtractIDs(updated.MemberIDs, group.MemberIDs)
+	if !h.checkMembers(ctx, w, added) {
+		return
+	}
+
+	if updated.DisplayName != group.DisplayName {
+		existing, err := h.groups.GetGroupByName(ctx, updated.DisplayName)
+		if err != nil {
+			writeStoreError(ctx, w, "look up group", err)
+			return
+		}
+		if existing != nil {
+			writeError(w, http.StatusConflict, "uniqueness", "A group with this displayName already exists")
+			return
+		}
+		if err := h.groups.RenameGroup(ctx, group.ID, updated.DisplayName); err != nil {
+			writeStoreError(ctx, w, "rename group", err)
+			return
+		}
+	}
+
+	if len(added) > 0 || len(subtractIDs(group.MemberIDs, updated.MemberIDs)) > 0 {
+		if err := h.groups.SetGroupMembers(ctx, group.ID, updated.MemberIDs); err != nil {
+			writeStoreError(ctx, w, "update group members", err)
+			return
+		}
+	}
+
+	saved, err := h.groups.GetGroup(ctx, group.ID)
+	if err != nil {
+		writeStoreError(ctx, w, "reload group", err)
+		return
+	}
+	if saved == nil {
+		writeError(w, http.StatusNotFound, "", "Group not found")
+		return
+	}
+
+	log.Printf("SCIM updated group: %s (%d members)", saved.DisplayName, len(saved.MemberIDs))
+	writeJSON(w, http.StatusOK, newGroupResource(baseURL(r), saved, includeMembers(r)))
+}
+
+// checkMembers verifies that every added member is a provisioned user,
+// writing a 400 response if not
+func (h *Handler) checkMembers(ctx context.Context, w http.ResponseWriter, ids []int) bool {
+	for _, id := range ids {
+		user, err := h.loadUser(ctx, id)
+		if err != nil {
+			writeStoreError(ctx, w, "load group member", err)
+			return false
+		}
+		if user == nil {
+			writeError(w, http.StatusBadRequest, "invalidValue", "Unknown group member "+strconv.Itoa(id))
+			return false
+		}
+	}
+	return true
+}
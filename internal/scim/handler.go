@@ -0,0 +1,277 @@
+// Package scim implements a SCIM 2.0 (RFC 7643/7644) provisioning server for
+// users and groups, so the IdP can push creates, updates and deactivations
+// into the same user store used by JIT provisioning.
+package scim
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"saml-poc/internal/database"
+)
+
+// BasePath is the URL prefix the handler is mounted on
+const BasePath = "/scim/v2/"
+
+// SCIM schema URNs
+const (
+	SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// contentType is the SCIM media type
+const contentType = "application/scim+json"
+
+// Paging limits for list requests
+const (
+	defaultCount = 100
+	maxCount     = 500
+)
+
+// maxBodySize caps request bodies
+const maxBodySize = 1 << 20
+
+// Handler serves the SCIM 2.0 Users and Groups endpoints
+type Handler struct {
+	users     database.UserStore
+	groups    database.GroupStore
+	token     string
+	dbTimeout time.Duration
+}
+
+// NewHandler creates a new SCIM handler authenticating requests with the given bearer token
+func NewHandler(users database.UserStore, groups database.GroupStore, token string, dbTimeout time.Duration) *Handler {
+	return &Handler{
+		users:     users,
+		groups:    groups,
+		token:     token,
+		dbTimeout: dbTimeout,
+	}
+}
+
+// ServeHTTP authenticates the request and dispatches it to the resource handlers
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="SCIM"`)
+		writeError(w, http.StatusUnauthorized, "", "Missing or invalid bearer token")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.dbTimeout)
+	defer cancel()
+
+	resource, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, BasePath), "/")
+	switch resource {
+	case "Users":
+		h.serveUsers(ctx, w, r, id)
+	case "Groups":
+		h.serveGroups(ctx, w, r, id)
+	case "ServiceProviderConfig":
+		h.serveServiceProviderConfig(w, r)
+	case "ResourceTypes":
+		h.serveResourceTypes(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "", "Unknown SCIM resource")
+	}
+}
+
+// authorized checks the bearer token in constant time
+func (h *Handler) authorized(r *http.Request) bool {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(h.token)) == 1
+}
+
+// serveServiceProviderConfig advertises the supported SCIM features
+func (h *Handler) serveServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{SchemaSPConfig},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": maxCount},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Static bearer token configured with SCIM_TOKEN",
+			"primary":     true,
+		}},
+	})
+}
+
+// serveResourceTypes lists the User and Group resource types
+func (h *Handler) serveResourceTypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		return
+	}
+
+	types := []map[string]interface{}{
+		{"schemas": []string{SchemaResourceType}, "id": "User", "name": "User", "endpoint": "/Users", "schema": SchemaUser},
+		{"schemas": []string{SchemaResourceType}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": SchemaGroup},
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(types),
+		StartIndex:   1,
+		ItemsPerPage: len(types),
+		Resources:    types,
+	})
+}
+
+// listResponse is the SCIM ListResponse message
+type listResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// listParams holds the filter and paging parameters of a list request
+type listParams struct {
+	filter     filter
+	startIndex int // 1-based
+	count      int
+}
+
+// parseListParams reads filter, startIndex and count from the query string
+func parseListParams(r *http.Request) (listParams, error) {
+	query := r.URL.Query()
+	params := listParams{startIndex: 1, count: defaultCount}
+
+	if value := query.Get("startIndex"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return params, fmt.Errorf("invalid startIndex %q", value)
+		}
+		if n > 1 {
+			params.startIndex = n
+		}
+	}
+
+	if value := query.Get("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return params, fmt.Errorf("invalid count %q", value)
+		}
+		params.count = n
+	}
+	if params.count < 0 {
+		params.count = 0
+	}
+	if params.count > maxCount {
+		params.count = maxCount
+	}
+
+	if value := query.Get("filter"); value != "" {
+		f, err := parseFilter(value)
+		if err != nil {
+			return params, err
+		}
+		params.filter = f
+	}
+
+	return params, nil
+}
+
+// page returns the bounds of the requested page within total results
+func (p listParams) page(total int) (start, end int) {
+	start = p.startIndex - 1
+	if start > total {
+		start = total
+	}
+	end = start + p.count
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// scimError is the SCIM error response message
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// writeError writes a SCIM error response
+func writeError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeJSON(w, status, scimError{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// writeStoreError maps a store failure to a SCIM error response
+func writeStoreError(ctx context.Context, w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, context.Canceled) && ctx.Err() != nil:
+		log.Printf("SCIM request canceled while trying to %s: %v", action, err)
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Printf("SCIM database timeout while trying to %s: %v", action, err)
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, "", "Database temporarily unavailable")
+	default:
+		log.Printf("SCIM failed to %s: %v", action, err)
+		writeError(w, http.StatusInternalServerError, "", "Internal server error")
+	}
+}
+
+// writeJSON writes a SCIM JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write SCIM response: %v", err)
+	}
+}
+
+// decodeBody decodes a JSON request body
+func decodeBody(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// baseURL returns the absolute URL of the SCIM endpoint for resource locations
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + strings.TrimSuffix(BasePath, "/")
+}
+
+// parseID parses a resource ID from the URL path
+func parseID(id string) (int, bool) {
+	n, err := strconv.Atoi(id)
+	return n, err == nil && n > 0
+}
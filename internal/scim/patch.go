@@ -0,0 +1,285 @@
+package scim
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	"saml-poc/internal/models"
+)
+
+// patchRequest is the body of a PATCH request
+type patchRequest struct {
+	Schemas    []string  `json:"schemas"`
+	Operations []patchOp `json:"Operations"`
+}
+
+// patchOp is a single PATCH operation
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// opName returns the lower-cased operation name, validating it
+func (op patchOp) opName() (string, error) {
+	name := strings.ToLower(op.Op)
+	switch name {
+	case "add", "replace", "remove":
+		return name, nil
+	}
+	return "", invalidValue("unsupported patch op %q", op.Op)
+}
+
+// pathlessValues returns the attributes of an add/replace operation without a path
+func (op patchOp) pathlessValues() (map[string]json.RawMessage, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(op.Value, &values); err != nil {
+		return nil, invalidValue("patch without path requires an object value")
+	}
+	return values, nil
+}
+
+// applyUserPatch applies PATCH operations to a user in memory.
+// Attributes the application does not store are ignored.
+func applyUserPatch(user *models.User, ops []patchOp) error {
+	for _, op := range ops {
+		name, err := op.opName()
+		if err != nil {
+			return err
+		}
+
+		if op.Path == "" {
+			if name == "remove" {
+				return &requestError{scimType: "noTarget", detail: "remove requires a path"}
+			}
+			values, err := op.pathlessValues()
+			if err != nil {
+				return err
+			}
+			for attr, value := range values {
+				if err := setUserAttribute(user, normalizePath(attr), value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		path := normalizePath(op.Path)
+		if name == "remove" {
+			if err := removeUserAttribute(user, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := setUserAttribute(user, path, op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setUserAttribute sets a single user attribute from a PATCH value
+func setUserAttribute(user *models.User, path string, value json.RawMessage) error {
+	// Azure AD addresses the work email as emails[type eq "work"].value
+	if strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value") {
+		path = "emails.value"
+	}
+
+	switch path {
+	case "username", "emails.value":
+		return unmarshalValue(path, value, &user.Email)
+	case "name.givenname":
+		return unmarshalValue(path, value, &user.FirstName)
+	case "name.familyname":
+		return unmarshalValue(path, value, &user.LastName)
+	case "name":
+		var name map[string]string
+		if err := unmarshalValue(path, value, &name); err != nil {
+			return err
+		}
+		for key, v := range name {
+			switch strings.ToLower(key) {
+			case "givenname":
+				user.FirstName = v
+			case "familyname":
+				user.LastName = v
+			}
+		}
+	case "emails":
+		var emails []emailValue
+		if err := unmarshalValue(path, value, &emails); err != nil {
+			return err
+		}
+		if email := primaryEmail(emails); email != "" {
+			user.Email = email
+		}
+	case "active":
+		var active flexBool
+		if err := unmarshalValue(path, value, &active); err != nil {
+			return err
+		}
+		setActive(user, bool(active))
+	default:
+		log.Printf("SCIM ignoring unsupported user attribute %q", path)
+	}
+	return nil
+}
+
+// removeUserAttribute clears a single user attribute
+func removeUserAttribute(user *models.User, path string) error {
+	switch path {
+	case "name.givenname":
+		user.FirstName = ""
+	case "name.familyname":
+		user.LastName = ""
+	case "name":
+		user.FirstName, user.LastName = "", ""
+	case "username", "emails", "active":
+		return &requestError{scimType: "mutability", detail: path + " cannot be removed"}
+	default:
+		log.Printf("SCIM ignoring removal of unsupported user attribute %q", path)
+	}
+	return nil
+}
+
+// applyGroupPatch applies PATCH operations to a group in memory, updating its
+// display name and member IDs
+func applyGroupPatch(group *models.Group, ops []patchOp) error {
+	for _, op := range ops {
+		name, err := op.opName()
+		if err != nil {
+			return err
+		}
+
+		if op.Path == "" {
+			if name == "remove" {
+				return &requestError{scimType: "noTarget", detail: "remove requires a path"}
+			}
+			values, err := op.pathlessValues()
+			if err != nil {
+				return err
+			}
+			for attr, value := range values {
+				if err := patchGroupAttribute(group, name, normalizePath(attr), value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := patchGroupAttribute(group, name, normalizePath(op.Path), op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchGroupAttribute applies one operation to a group attribute
+func patchGroupAttribute(group *models.Group, op, path string, value json.RawMessage) error {
+	// remove with path members[value eq "42"] removes a single member
+	if strings.HasPrefix(path, "members[") && strings.HasSuffix(path, "]") {
+		if op != "remove" {
+			return &requestError{scimType: "invalidPath", detail: "member filters are only supported with remove"}
+		}
+		f, err := parseFilter(path[len("members[") : len(path)-1])
+		if err != nil {
+			return &requestError{scimType: "invalidFilter", detail: err.Error()}
+		}
+		var kept []int
+		for _, id := range group.MemberIDs {
+			if !f.match(attributeSet{"value": {strconv.Itoa(id)}}) {
+				kept = append(kept, id)
+			}
+		}
+		group.MemberIDs = kept
+		return nil
+	}
+
+	switch path {
+	case "displayname":
+		if op == "remove" {
+			return &requestError{scimType: "mutability", detail: "displayName cannot be removed"}
+		}
+		return unmarshalValue(path, value, &group.DisplayName)
+	case "members":
+		var ids []int
+		if len(value) > 0 {
+			var members []reference
+			if err := unmarshalValue(path, value, &members); err != nil {
+				return err
+			}
+			parsed, err := memberIDs(members)
+			if err != nil {
+				return err
+			}
+			ids = parsed
+		}
+
+		switch {
+		case op == "add":
+			group.MemberIDs = unionIDs(group.MemberIDs, ids)
+		case op == "replace":
+			group.MemberIDs = ids
+		case len(value) == 0:
+			group.MemberIDs = nil
+		default:
+			group.MemberIDs = subtractIDs(group.MemberIDs, ids)
+		}
+	default:
+		log.Printf("SCIM ignoring unsupported group attribute %q", path)
+	}
+	return nil
+}
+
+// unmarshalValue decodes a PATCH value, reporting a SCIM invalidValue error
+func unmarshalValue(path string, value json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(value, v); err != nil {
+		return invalidValue("invalid value for %s", path)
+	}
+	return nil
+}
+
+// memberIDs parses member references into user IDs
+func memberIDs(members []reference) ([]int, error) {
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		id, ok := parseID(member.Value)
+		if !ok {
+			return nil, invalidValue("invalid member %q", member.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// unionIDs returns ids followed by the entries of add not already present
+func unionIDs(ids, add []int) []int {
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, id := range add {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// subtractIDs returns ids without the entries of remove
+func subtractIDs(ids, remove []int) []int {
+	drop := make(map[int]bool, len(remove))
+	for _, id := range remove {
+		drop[id] = true
+	}
+	var kept []int
+	for _, id := range ids {
+		if !drop[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,230 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"saml-poc/internal/models"
+)
+
+// meta is the SCIM resource metadata
+type meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created"`
+	LastModified string `json:"lastModified"`
+	Location     string `json:"location"`
+}
+
+// newMeta builds resource metadata
+func newMeta(resourceType, location string, created, modified time.Time) meta {
+	return meta{
+		ResourceType: resourceType,
+		Created:      created.UTC().Format(time.RFC3339),
+		LastModified: modified.UTC().Format(time.RFC3339),
+		Location:     location,
+	}
+}
+
+// nameValue is the SCIM "name" complex attribute
+type nameValue struct {
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+	Formatted  string `json:"formatted,omitempty"`
+}
+
+// emailValue is one entry of the SCIM "emails" attribute
+type emailValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// reference points at another resource, used for group members and user groups
+type reference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// userResource is the SCIM representation of a user
+type userResource struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	UserName    string       `json:"userName"`
+	Name        nameValue    `json:"name"`
+	DisplayName string       `json:"displayName"`
+	Emails      []emailValue `json:"emails"`
+	Active      bool         `json:"active"`
+	Groups      []reference  `json:"groups,omitempty"`
+	Meta        meta         `json:"meta"`
+}
+
+// groupResource is the SCIM representation of a group
+type groupResource struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	DisplayName string      `json:"displayName"`
+	Members     []reference `json:"members,omitempty"`
+	Meta        meta        `json:"meta"`
+}
+
+// newUserResource converts a user and its groups to a SCIM resource.
+// active reflects whether the user may currently sign in.
+func newUserResource(base string, user *models.User, groups []*models.Group) userResource {
+	location := fmt.Sprintf("%s/Users/%d", base, user.ID)
+	resource := userResource{
+		Schemas:  []string{SchemaUser},
+		ID:       strconv.Itoa(user.ID),
+		UserName: user.Email,
+		Name: nameValue{
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+			Formatted:  strings.TrimSpace(user.FullName()),
+		},
+		DisplayName: strings.TrimSpace(user.FullName()),
+		Emails:      []emailValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      user.IsAuthorized(),
+		Meta:        newMeta("User", location, user.CreatedAt, user.UpdatedAt),
+	}
+
+	for _, group := range groups {
+		resource.Groups = append(resource.Groups, reference{
+			Value:   strconv.Itoa(group.ID),
+			Display: group.DisplayName,
+			Ref:     fmt.Sprintf("%s/Groups/%d", base, group.ID),
+		})
+	}
+
+	return resource
+}
+
+// newGroupResource converts a group to a SCIM resource, optionally without members
+func newGroupResource(base string, group *models.Group, withMembers bool) groupResource {
+	location := fmt.Sprintf("%s/Groups/%d", base, group.ID)
+	resource := groupResource{
+		Schemas:     []string{SchemaGroup},
+		ID:          strconv.Itoa(group.ID),
+		DisplayName: group.DisplayName,
+		Meta:        newMeta("Group", location, group.CreatedAt, group.UpdatedAt),
+	}
+
+	if withMembers {
+		for _, id := range group.MemberIDs {
+			resource.Members = append(resource.Members, reference{
+				Value: strconv.Itoa(id),
+				Ref:   fmt.Sprintf("%s/Users/%d", base, id),
+			})
+		}
+	}
+
+	return resource
+}
+
+// userAttributes returns the filterable attributes of a user
+func userAttributes(user *models.User) attributeSet {
+	return attributeSet{
+		"id":                {strconv.Itoa(user.ID)},
+		"username":          {user.Email},
+		"name.givenname":    {user.FirstName},
+		"name.familyname":   {user.LastName},
+		"displayname":       {strings.TrimSpace(user.FullName())},
+		"emails":            {user.Email},
+		"emails.value":      {user.Email},
+		"active":            {strconv.FormatBool(user.IsAuthorized())},
+		"meta.created":      {user.CreatedAt.UTC().Format(time.RFC3339)},
+		"meta.lastmodified": {user.UpdatedAt.UTC().Format(time.RFC3339)},
+	}
+}
+
+// groupAttributes returns the filterable attributes of a group
+func groupAttributes(group *models.Group) attributeSet {
+	members := make([]string, len(group.MemberIDs))
+	for i, id := range group.MemberIDs {
+		members[i] = strconv.Itoa(id)
+	}
+
+	return attributeSet{
+		"id":                {strconv.Itoa(group.ID)},
+		"displayname":       {group.DisplayName},
+		"members":           members,
+		"members.value":     members,
+		"meta.created":      {group.CreatedAt.UTC().Format(time.RFC3339)},
+		"meta.lastmodified": {group.UpdatedAt.UTC().Format(time.RFC3339)},
+	}
+}
+
+// userInput is the body of a user POST or PUT
+type userInput struct {
+	UserName string       `json:"userName"`
+	Name     *nameValue   `json:"name"`
+	Emails   []emailValue `json:"emails"`
+	Active   *flexBool    `json:"active"`
+}
+
+// email returns userName, falling back to the primary (or first) email
+func (in userInput) email() string {
+	if in.UserName != "" {
+		return in.UserName
+	}
+	return primaryEmail(in.Emails)
+}
+
+// primaryEmail picks the primary email, or the first one
+func primaryEmail(emails []emailValue) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+// groupInput is the body of a group POST or PUT
+type groupInput struct {
+	DisplayName string      `json:"displayName"`
+	Members     []reference `json:"members"`
+}
+
+// flexBool accepts JSON booleans and the "True"/"False" strings some IdPs send
+type flexBool bool
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var value bool
+	if err := json.Unmarshal(data, &value); err == nil {
+		*b = flexBool(value)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	value, err := strconv.ParseBool(strings.ToLower(text))
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", text)
+	}
+	*b = flexBool(value)
+	return nil
+}
+
+// requestError is a client error reported with a SCIM scimType
+type requestError struct {
+	scimType string
+	detail   string
+}
+
+func (e *requestError) Error() string {
+	return e.detail
+}
+
+// invalidValue returns a requestError with scimType invalidValue
+func invalidValue(format string, args ...interface{}) error {
+	return &requestError{scimType: "invalidValue", detail: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,334 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"saml-poc/internal/models"
+)
+
+// listBatchSize is the page size used when scanning the user store for filtering
+const listBatchSize = 500
+
+// serveUsers dispatches /Users and /Users/{id} requests
+func (h *Handler) serveUsers(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) {
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.listUsers(ctx, w, r)
+		case http.MethodPost:
+			h.createUser(ctx, w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		}
+		return
+	}
+
+	userID, ok := parseID(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "User not found")
+		return
+	}
+
+	user, err := h.loadUser(ctx, userID)
+	if err != nil {
+		writeStoreError(ctx, w, "load user", err)
+		return
+	}
+	if user == nil {
+		writeError(w, http.StatusNotFound, "", "User not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.writeUser(ctx, w, r, http.StatusOK, user)
+	case http.MethodPut:
+		h.replaceUser(ctx, w, r, user)
+	case http.MethodPatch:
+		h.patchUser(ctx, w, r, user)
+	case http.MethodDelete:
+		h.deleteUser(ctx, w, user)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+	}
+}
+
+// loadUser returns the user with the given ID; deprovisioned users are treated as deleted
+func (h *Handler) loadUser(ctx context.Context, id int) (*models.User, error) {
+	user, err := h.users.GetByID(ctx, id)
+	if err != nil || user == nil || user.Status == models.UserStatusDeprovisioned {
+		return nil, err
+	}
+	return user, nil
+}
+
+// listUsers returns users matching the optional filter
+func (h *Handler) listUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	params, err := parseListParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	var users []*models.User
+	if email, ok := emailLookup(params.filter); ok {
+		// IdPs check for an existing account with userName eq "..." before creating it
+		user, err := h.users.GetByEmail(ctx, email)
+		if err != nil {
+			writeStoreError(ctx, w, "look up user", err)
+			return
+		}
+		if user != nil && user.Status != models.UserStatusDeprovisioned {
+			users = append(users, user)
+		}
+	} else {
+		users, err = h.allUsers(ctx)
+		if err != nil {
+			writeStoreError(ctx, w, "list users", err)
+			return
+		}
+	}
+
+	var matched []*models.User
+	for _, user := range users {
+		if params.filter == nil || params.filter.match(userAttributes(user)) {
+			matched = append(matched, user)
+		}
+	}
+
+	start, end := params.page(len(matched))
+	base := baseURL(r)
+	resources := make([]userResource, 0, end-start)
+	for _, user := range matched[start:end] {
+		groups, err := h.groups.ListUserGroups(ctx, user.ID)
+		if err != nil {
+			writeStoreError(ctx, w, "load user groups", err)
+			return
+		}
+		resources = append(resources, newUserResource(base, user, groups))
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(matched),
+		StartIndex:   params.startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// emailLookup returns the email of a userName or emails equality filter
+func emailLookup(f filter) (string, bool) {
+	for _, path := range []string{"username", "emails", "emails.value"} {
+		if email, ok := equalityOn(f, path); ok {
+			return email, true
+		}
+	}
+	return "", false
+}
+
+// allUsers loads every provisioned user ordered by ID
+func (h *Handler) allUsers(ctx context.Context) ([]*models.User, error) {
+	var users []*models.User
+	for offset := 0; ; offset += listBatchSize {
+		batch, err := h.users.List(ctx, listBatchSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range batch {
+			if user.Status != models.UserStatusDeprovisioned {
+				users = append(users, user)
+			}
+		}
+		if len(batch) < listBatchSize {
+			break
+		}
+	}
+
+	sort.Slice(users, func(i, k int) bool { return users[i].ID < users[k].ID })
+	return users, nil
+}
+
+// createUser provisions a new user. A previously deprovisioned account with
+// the same email is reactivated instead, keeping its ID and linked identities.
+func (h *Handler) createUser(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var input userInput
+	if err := decodeBody(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	email := models.NormalizeEmail(input.email())
+	if email == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	existing, err := h.users.GetByEmail(ctx, email)
+	if err != nil {
+		writeStoreError(ctx, w, "look up user", err)
+		return
+	}
+	if existing != nil && existing.Status != models.UserStatusDeprovisioned {
+		writeError(w, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+		return
+	}
+
+	var firstName, lastName string
+	if input.Name != nil {
+		firstName, lastName = input.Name.GivenName, input.Name.FamilyName
+	}
+
+	user := existing
+	if user == nil {
+		var created bool
+		user, created, err = h.users.GetOrCreate(ctx, email, firstName, lastName, models.UserStatusActive)
+		if err != nil {
+			writeStoreError(ctx, w, "create user", err)
+			return
+		}
+		if !created {
+			writeError(w, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+			return
+		}
+	} else {
+		user.FirstName, user.LastName = firstName, lastName
+		user.Status = models.UserStatusActive
+		log.Printf("SCIM reactivating deprovisioned user: %s", user.Email)
+	}
+
+	if input.Active != nil {
+		setActive(user, bool(*input.Active))
+	}
+	if existing != nil || !user.IsAuthorized() {
+		if err := h.users.Update(ctx, user); err != nil {
+			writeStoreError(ctx, w, "update user", err)
+			return
+		}
+	}
+
+	log.Printf("SCIM provisioned user: %s (status: %s)", user.Email, user.Status)
+	w.Header().Set("Location", newUserResource(baseURL(r), user, nil).Meta.Location)
+	h.writeUser(ctx, w, r, http.StatusCreated, user)
+}
+
+// replaceUser replaces a user's attributes (PUT)
+func (h *Handler) replaceUser(ctx context.Context, w http.ResponseWriter, r *http.Request, user *models.User) {
+	var input userInput
+	if err := decodeBody(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	if email := input.email(); email != "" {
+		user.Email = email
+	}
+	user.FirstName, user.LastName = "", ""
+	if input.Name != nil {
+		user.FirstName, user.LastName = input.Name.GivenName, input.Name.FamilyName
+	}
+	if input.Active != nil {
+		setActive(user, bool(*input.Active))
+	}
+
+	h.saveUser(ctx, w, r, user)
+}
+
+// patchUser applies PATCH operations to a user
+func (h *Handler) patchUser(ctx context.Context, w http.ResponseWriter, r *http.Request, user *models.User) {
+	var patch patchRequest
+	if err := decodeBody(r, &patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	if err := applyUserPatch(user, patch.Operations); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	h.saveUser(ctx, w, r, user)
+}
+
+// saveUser stores a modified user, rejecting an email already used by another account
+func (h *Handler) saveUser(ctx context.Context, w http.ResponseWriter, r *http.Request, user *models.User) {
+	user.Email = models.NormalizeEmail(user.Email)
+	if user.Email == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	other, err := h.users.GetByEmail(ctx, user.Email)
+	if err != nil {
+		writeStoreError(ctx, w, "look up user", err)
+		return
+	}
+	if other != nil && other.ID != user.ID {
+		writeError(w, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+		return
+	}
+
+	if err := h.users.Update(ctx, user); err != nil {
+		writeStoreError(ctx, w, "update user", err)
+		return
+	}
+
+	log.Printf("SCIM updated user: %s (status: %s)", user.Email, user.Status)
+	h.writeUser(ctx, w, r, http.StatusOK, user)
+}
+
+// deleteUser deprovisions a user
+func (h *Handler) deleteUser(ctx context.Context, w http.ResponseWriter, user *models.User) {
+	if err := h.users.Delete(ctx, user.ID); err != nil {
+		writeStoreError(ctx, w, "delete user", err)
+		return
+	}
+
+	log.Printf("SCIM deprovisioned user: %s", user.Email)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUser writes a user resource including its group memberships
+func (h *Handler) writeUser(ctx context.Context, w http.ResponseWriter, r *http.Request, status int, user *models.User) {
+	groups, err := h.groups.ListUserGroups(ctx, user.ID)
+	if err != nil {
+		writeStoreError(ctx, w, "load user groups", err)
+		return
+	}
+	writeJSON(w, status, newUserResource(baseURL(r), user, groups))
+}
+
+// setActive applies the SCIM active flag. Deactivation suspends the user;
+// activation lifts IdP deactivations and approves pending users, but leaves
+// suspensions made by the application (expired or rejected access) in place.
+func setActive(user *models.User, active bool) {
+	if !active {
+		if user.Status == models.UserStatusActive || user.Status == models.UserStatusPending {
+			user.Suspend(models.SuspensionReasonDeactivated)
+		}
+		return
+	}
+
+	switch {
+	case user.IsPending():
+		user.Status = models.UserStatusActive
+	case user.IsSuspended() && user.SuspensionReason == models.SuspensionReasonDeactivated:
+		user.Status = models.UserStatusActive
+		user.SuspensionReason = ""
+	}
+}
+
+// writeRequestError writes a client error from request processing
+func writeRequestError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		writeError(w, http.StatusBadRequest, reqErr.scimType, reqErr.detail)
+		return
+	}
+	writeError(w, http.StatusBadRequest, "invalidSyntax", strings.TrimSpace(err.Error()))
+}
@@ -0,0 +1,112 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"saml-poc/internal/config"
+	"saml-poc/internal/models"
+)
+
+// apiTokenUse marks API tokens, so tokens issued for other purposes with the same key are refused
+const apiTokenUse = "api"
+
+// APITokens mints and verifies short-lived bearer tokens for users who signed in with SAML
+type APITokens struct {
+	keys       *KeySet
+	issuer     string
+	audience   string
+	ttl        time.Duration
+	rolesClaim string
+}
+
+// APIClaims are the verified claims of an API token
+type APIClaims struct {
+	UserID    int
+	Email     string
+	Roles     []string
+	ExpiresAt time.Time
+}
+
+// NewAPITokens creates an API token issuer signing with keys
+func NewAPITokens(cfg *config.APITokenConfig, keys *KeySet) *APITokens {
+	return &APITokens{
+		keys:       keys,
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		ttl:        cfg.TTL,
+		rolesClaim: cfg.RolesClaim,
+	}
+}
+
+// Keys returns the key set that signs API tokens
+func (a *APITokens) Keys() *KeySet {
+	return a.keys
+}
+
+// TTL returns how long minted tokens are valid
+func (a *APITokens) TTL() time.Duration {
+	return a.ttl
+}
+
+// Mint returns a signed API token for user with their roles
+func (a *APITokens) Mint(user *models.User, roles []string, now time.Time) (string, error) {
+	if roles == nil {
+		roles = []string{}
+	}
+
+	return a.keys.Sign(jwt.MapClaims{
+		"iss":        a.issuer,
+		"aud":        a.audience,
+		"sub":        strconv.Itoa(user.ID),
+		"iat":        now.Unix(),
+		"exp":        now.Add(a.ttl).Unix(),
+		"email":      user.Email,
+		"name":       strings.TrimSpace(user.FullName()),
+		a.rolesClaim: roles,
+		"token_use":  apiTokenUse,
+	})
+}
+
+// Verify checks an API token's signature, expiry, issuer and audience
+func (a *APITokens) Verify(raw string) (*APIClaims, error) {
+	claims := jwt.MapClaims{}
+	if err := a.keys.Verify(raw, claims); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(a.issuer, true) || !claims.VerifyAudience(a.audience, true) {
+		return nil, errors.New("token was issued for another issuer or audience")
+	}
+	if use, _ := claims["token_use"].(string); use != apiTokenUse {
+		return nil, errors.New("not an API token")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("token has no expiry")
+	}
+
+	sub, _ := claims["sub"].(string)
+	userID, err := strconv.Atoi(sub)
+	if err != nil {
+		return nil, errors.New("invalid token subject")
+	}
+
+	result := &APIClaims{UserID: userID}
+	result.Email, _ = claims["email"].(string)
+	if exp, ok := claims["exp"].(float64); ok {
+		result.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	if roles, ok := claims[a.rolesClaim].([]interface{}); ok {
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				result.Roles = append(result.Roles, s)
+			}
+		}
+	}
+	return result, nil
+}
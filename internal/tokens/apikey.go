@@ -0,0 +1,32 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"saml-poc/internal/models"
+)
+
+// apiKeyHintLength is how much of a key is kept in clear to tell keys apart
+const apiKeyHintLength = 10
+
+// GenerateAPIKey returns a new random API key, the hash to store and a short hint to display
+func GenerateAPIKey() (key, hash, hint string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key = models.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, HashAPIKey(key), key[:apiKeyHintLength], nil
+}
+
+// HashAPIKey returns the stored form of an API key. Keys are random and long,
+// so a fast unsalted hash is enough and lets keys be looked up by hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+// Package tokens signs and verifies the JWTs this service issues and
+// publishes the public key as a JSON Web Key Set for verifiers.
+package tokens
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// KeySet signs tokens with an RSA key and verifies tokens signed by it
+type KeySet struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+// NewKeySet creates a key set for an RSA private key
+func NewKeySet(key *rsa.PrivateKey) *KeySet {
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+	return &KeySet{key: key, keyID: base64.RawURLEncoding.EncodeToString(sum[:8])}
+}
+
+// LoadKeySet reads a PEM-encoded RSA private key (PKCS#1 or PKCS#8)
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode signing key %s: no PEM data", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return NewKeySet(key), nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key is not RSA")
+	}
+	return NewKeySet(key), nil
+}
+
+// Sign returns a signed RS256 JWT for claims
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.keyID
+	signed, err := token.SignedString(k.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// Verify checks a JWT's signature and standard time claims and decodes it into claims
+func (k *KeySet) Verify(raw string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Header["alg"])
+		}
+		if kid, _ := token.Header["kid"].(string); kid != k.keyID {
+			return nil, errors.New("unknown signing key")
+		}
+		return &k.key.PublicKey, nil
+	})
+	return err
+}
+
+// jwk is a public key in JSON Web Key format
+type jwk struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// ServeHTTP serves the public key as a JSON Web Key Set
+func (k *KeySet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pub := k.key.PublicKey
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{
+		Keys: []jwk{{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: "RS256",
+			KeyID:     k.keyID,
+			Modulus:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(set)
+}
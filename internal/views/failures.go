@@ -0,0 +1,208 @@
+package views
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"saml-poc/internal/requestid"
+)
+
+// ErrorCodeHeader carries the failure code in the response, for clients such
+// as forward-auth proxies that do not read the page
+const ErrorCodeHeader = "X-Error-Code"
+
+// CodePendingApproval is sent in ErrorCodeHeader with the pending approval
+// page, which is not a failure page but also refuses access
+const CodePendingApproval = "AUTH-209"
+
+// Failure is a user-facing failure mode. Codes are stable so users can quote
+// them to support and documentation can refer to them.
+type Failure struct {
+	Code    string
+	Status  int
+	Title   string
+	Message string
+	Help    string
+	// Retry offers a link to sign in again
+	Retry bool
+	// page is the template shown, PageError unless set
+	page string
+}
+
+// Sign-in failures: the SAML exchange with the IdP did not complete
+var (
+	FailureInvalidResponse = Failure{
+		Code:    "SSO-101",
+		Status:  http.StatusForbidden,
+		Title:   "Sign-In Failed",
+		Message: "The response from your identity provider could not be verified.",
+		Help:    "Try signing in again. If it keeps failing, your identity provider or this application may be misconfigured; contact your IT administrator.",
+		Retry:   true,
+	}
+	FailureSignInExpired = Failure{
+		Code:    "SSO-102",
+		Status:  http.StatusForbidden,
+		Title:   "Sign-In Expired",
+		Message: "Your sign-in could not be matched to a sign-in started from this browser.",
+		Help:    "The sign-in may have taken too long, been started in another browser, or cookies may be blocked. Make sure cookies are enabled and try again.",
+		Retry:   true,
+	}
+	FailureBadSignInRequest = Failure{
+		Code:    "SSO-103",
+		Status:  http.StatusBadRequest,
+		Title:   "Sign-In Failed",
+		Message: "The sign-in request could not be read.",
+		Help:    "Start again from the application rather than a bookmarked or reused sign-in page.",
+		Retry:   true,
+	}
+	FailureNoSession = Failure{
+		Code:    "SSO-104",
+		Status:  http.StatusUnauthorized,
+		Title:   "Not Signed In",
+		Message: "We could not find your sign-in session.",
+		Help:    "Please sign in again.",
+		Retry:   true,
+	}
+	FailureSessionError = Failure{
+		Code:    "SSO-105",
+		Status:  http.StatusInternalServerError,
+		Title:   "Sign-In Failed",
+		Message: "Your sign-in session could not be created or ended.",
+		Help:    "Please try again. If it keeps failing, contact support with the reference below.",
+		Retry:   true,
+	}
+)
+
+// Account failures: the user signed in but may not use the application
+var (
+	FailureMissingAttributes = Failure{
+		Code:    "AUTH-201",
+		Status:  http.StatusBadRequest,
+		Title:   "Sign-In Information Incomplete",
+		Message: "Your identity provider did not send all the information needed to sign you in.",
+		Help:    "This is usually an identity provider configuration problem. Please contact your IT administrator.",
+		page:    PageAccessDenied,
+	}
+	FailureUnknownUser = Failure{
+		Code:    "AUTH-202",
+		Status:  http.StatusForbidden,
+		Title:   "Access Denied",
+		Message: "Your account does not have access to this application.",
+		Help:    "Ask your administrator to grant you access to this application.",
+		page:    PageAccessDenied,
+	}
+	FailurePolicyDenied = Failure{
+		Code:    "AUTH-203",
+		Status:  http.StatusForbidden,
+		Title:   "Access Denied",
+		Message: "You do not have access to this application.",
+		Help:    "Contact your administrator if you believe you should have access.",
+		page:    PageAccessDenied,
+	}
+	FailureSuspended = Failure{
+		Code:    "AUTH-204",
+		Status:  http.StatusForbidden,
+		Title:   "Account Suspended",
+		Message: "Your account has been suspended.",
+		Help:    "Contact your administrator to have your account reinstated.",
+		page:    PageAccessDenied,
+	}
+	FailureExpired = Failure{
+		Code:    "AUTH-205",
+		Status:  http.StatusForbidden,
+		Title:   "Access Expired",
+		Message: "Your access to this application has expired.",
+		Help:    "Contact your administrator to have your access extended.",
+		page:    PageAccessDenied,
+	}
+	FailureDeprovisioned = Failure{
+		Code:    "AUTH-206",
+		Status:  http.StatusForbidden,
+		Title:   "Account Removed",
+		Message: "Your account has been removed.",
+		Help:    "Contact your administrator if you need access again.",
+		page:    PageAccessDenied,
+	}
+	FailureAccessDenied = Failure{
+		Code:    "AUTH-207",
+		Status:  http.StatusForbidden,
+		Title:   "Access Denied",
+		Message: "You do not have access to this application.",
+		Help:    "Contact your administrator if you believe you should have access.",
+		page:    PageAccessDenied,
+	}
+	FailureRoleRequired = Failure{
+		Code:    "AUTH-208",
+		Status:  http.StatusForbidden,
+		Title:   "Access Denied",
+		Message: "You do not have the role this page requires.",
+		Help:    "Contact your administrator if you believe you should have access.",
+		page:    PageAccessDenied,
+	}
+)
+
+// Internal failures: the request could not be handled
+var (
+	FailureUnavailable = Failure{
+		Code:    "SYS-501",
+		Status:  http.StatusServiceUnavailable,
+		Title:   "Service Temporarily Unavailable",
+		Message: "We could not verify your account in time.",
+		Help:    "Please try again in a few seconds.",
+		Retry:   true,
+	}
+	FailureInternal = Failure{
+		Code:    "SYS-502",
+		Status:  http.StatusInternalServerError,
+		Title:   "Something Went Wrong",
+		Message: "We could not verify your account because of an internal error.",
+		Help:    "Please try again later. If it keeps failing, contact support with the reference below.",
+		Retry:   true,
+	}
+)
+
+// WithMessage returns a copy of f showing message, if it is not empty
+func (f Failure) WithMessage(message string) Failure {
+	if message != "" {
+		f.Message = message
+	}
+	return f
+}
+
+// failurePage is the data of the error and access-denied pages
+type failurePage struct {
+	Failure
+	// Reference is the request ID, also written to the log
+	Reference string
+	// RetryURL signs the user in again
+	RetryURL string
+}
+
+// RenderFailure shows the page for f with the request ID as the support
+// reference. The code, reference and cause, which may be nil, are logged
+// together so support can find the details from what the user quotes.
+func (v *Renderer) RenderFailure(w http.ResponseWriter, r *http.Request, f Failure, cause error) {
+	ref := requestid.FromContext(r.Context())
+	if cause != nil {
+		log.Printf("Request %s %s %s failed with %s: %v", ref, r.Method, r.URL.Path, f.Code, cause)
+	} else {
+		log.Printf("Request %s %s %s failed with %s: %s", ref, r.Method, r.URL.Path, f.Code, f.Title)
+	}
+
+	w.Header().Set(ErrorCodeHeader, f.Code)
+	name := f.page
+	if name == "" {
+		name = PageError
+	}
+	v.Render(w, f.Status, name, f.Title, failurePage{Failure: f, Reference: ref, RetryURL: retryURL(r)})
+}
+
+// retryURL returns the page that starts a fresh sign-in: the requested page
+// itself for page loads, otherwise the landing page
+func retryURL(r *http.Request) string {
+	if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/saml/") {
+		return r.URL.RequestURI()
+	}
+	return "/"
+}
@@ -0,0 +1,156 @@
+package views
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"saml-poc/internal/config"
+)
+
+// defaultTemplates are the built-in templates; files in the template directory replace them by name
+//
+//go:embed templates
+var defaultTemplates embed.FS
+
+// Page names accepted by Render
+const (
+	PageHome         = "home"
+	PageDebug        = "debug"
+	PageApprovals    = "approvals"
+	PagePending      = "pending"
+	PageAccessDenied = "access_denied"
+	PageError        = "error"
+	PageLogout       = "logout"
+	PageSignIn       = "signin"
+)
+
+// pageNames are the pages parsed at startup
+var pageNames = []string{PageHome, PageDebug, PageApprovals, PagePending, PageAccessDenied, PageError, PageLogout, PageSignIn}
+
+// sharedTemplates are parsed into every page: the layout and its partials
+var sharedTemplates = []string{
+	"layout.html",
+	"partials/header.html",
+	"partials/footer.html",
+	"partials/notice.html",
+	"partials/failure.html",
+}
+
+// Theme is the branding available to every template as .Theme
+type Theme struct {
+	Name         string
+	LogoURL      string
+	PrimaryColor string
+}
+
+// Renderer renders the HTML pages from the embedded templates and any overrides
+type Renderer struct {
+	pages map[string]*template.Template
+	theme Theme
+}
+
+// page is the data passed to the layout; the page's own data is .Data
+type page struct {
+	Theme Theme
+	Title string
+	Data  interface{}
+}
+
+// New parses the page templates, preferring files in cfg.TemplateDir over the embedded defaults
+func New(cfg *config.UIConfig) (*Renderer, error) {
+	v := &Renderer{
+		pages: make(map[string]*template.Template, len(pageNames)),
+		theme: Theme{Name: cfg.BrandName, LogoURL: cfg.LogoURL, PrimaryColor: cfg.PrimaryColor},
+	}
+
+	for _, name := range pageNames {
+		tmpl := template.New(name).Funcs(funcs)
+		for _, file := range append(sharedTemplates, name+".html") {
+			text, err := readTemplate(cfg.TemplateDir, file)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := tmpl.New(file).Parse(text); err != nil {
+				return nil, fmt.Errorf("failed to parse template %s: %w", file, err)
+			}
+		}
+		v.pages[name] = tmpl
+	}
+
+	return v, nil
+}
+
+// readTemplate returns the override for file from dir if there is one, otherwise the embedded default
+func readTemplate(dir, file string) (string, error) {
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err == nil {
+			return string(data), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to read template %s: %w", file, err)
+		}
+	}
+
+	data, err := defaultTemplates.ReadFile("templates/" + file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template %s: %w", file, err)
+	}
+	return string(data), nil
+}
+
+// Render writes the named page with the given status. The page is rendered
+// into a buffer first so a template error produces a plain 500 rather than
+// half a page.
+func (v *Renderer) Render(w http.ResponseWriter, status int, name, title string, data interface{}) {
+	tmpl, ok := v.pages[name]
+	if !ok {
+		log.Printf("Unknown page template %q", name)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout", page{Theme: v.theme, Title: title, Data: data}); err != nil {
+		log.Printf("Failed to render page %s: %v", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// funcs are the helpers available to templates
+var funcs = template.FuncMap{
+	// enabled formats a feature flag for display
+	"enabled": func(b bool) string {
+		if b {
+			return "ENABLED"
+		}
+		return "DISABLED"
+	},
+	// notice builds the data of the notice partial; kind is success, warning or error
+	"notice": func(kind, text string) notice {
+		return notice{Kind: kind, Text: text}
+	},
+	// percent turns a fraction into a percentage
+	"percent": func(f float64) float64 {
+		return f * 100
+	},
+}
+
+// notice is the data of the notice partial
+type notice struct {
+	Kind string
+	Text string
+}